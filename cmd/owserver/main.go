@@ -1,37 +1,175 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"path"
+	"syscall"
 
 	"github.com/wostzone/wost-go/pkg/config"
 	"github.com/wostzone/wost-go/pkg/logging"
-	"github.com/wostzone/wost-go/pkg/proc"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/configcheck"
+	"github.com/wostzone/owserver/internal/dryrun"
 )
 
+// newSubstituteMap returns the template keywords that are substituted in the configuration file
+func newSubstituteMap(hubConfig *config.HubConfig) map[string]string {
+	return map[string]string{
+		"{clientID}":     internal.PluginID,
+		"{homeFolder}":   hubConfig.HomeFolder,
+		"{configFolder}": hubConfig.ConfigFolder,
+		"{logsFolder}":   hubConfig.LogFolder,
+		"{certsFolder}":  hubConfig.CertsFolder,
+	}
+}
+
+// checkConfig validates a configuration file and optionally probes its gateway
+// Usage: owserver config check [-probe] [configFile]
+// The configuration file defaults to owserver.yaml in the hub config folder.
+// This returns the exit code, 0 if the configuration is valid and 1 if it is not.
+func checkConfig(args []string) int {
+	flags := flag.NewFlagSet("config check", flag.ContinueOnError)
+	probe := flags.Bool("probe", false, "Also read the gateway to check that it can be reached")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+	// the hub configuration is only needed for its folders, a missing hub.yaml is fine
+	logrus.SetLevel(logrus.FatalLevel)
+	hubConfig, _ := config.LoadAllConfig(nil, "", internal.PluginID, nil)
+	logrus.SetLevel(logrus.WarnLevel)
+	configFile := path.Join(hubConfig.ConfigFolder, internal.PluginID+".yaml")
+	if flags.NArg() > 0 {
+		configFile = flags.Arg(0)
+	}
+	serviceConfig, err := internal.LoadConfigFile(configFile, newSubstituteMap(hubConfig))
+	if err != nil {
+		fmt.Printf("%s is invalid:\n", configFile)
+		var problems configcheck.Problems
+		if errors.As(err, &problems) {
+			for _, problem := range problems {
+				fmt.Printf("  %s\n", problem)
+			}
+		} else {
+			fmt.Printf("  %s\n", err)
+		}
+		return 1
+	}
+	fmt.Printf("%s is valid\n", configFile)
+	if *probe {
+		nodeCount, err := internal.ProbeGateway(serviceConfig)
+		if err != nil {
+			fmt.Printf("Gateway can't be read: %s\n", err)
+			return 1
+		}
+		fmt.Printf("Gateway is reachable with %d 1-wire nodes\n", nodeCount)
+	}
+	return 0
+}
+
+// waitForSignal waits until SIGINT or SIGTERM is received
+// Unlike proc.WaitForSignal this only logs the signal, so stdout stays clean for the dry-run output.
+func waitForSignal() {
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signalChannel
+	logrus.Warningf("Received signal: %s", sig)
+}
+
 // Main entry to WoST protocol adapter for owserver-v2
 // This setup the configuration from file and commandline parameters and launches the service
+// Use -exportModels {folder} to export the Thing Models of the connected devices instead.
+// Use -dryRun {file} to write the Things as JSON lines instead of publishing them, '-' for stdout.
+// Use 'config check [-probe] [configFile]' to validate the configuration file instead.
 func main() {
-	serviceConfig := internal.OWServerPBConfig{}
-	hubConfig, err := config.LoadAllConfig(os.Args, "", internal.PluginID, &serviceConfig)
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(checkConfig(os.Args[3:]))
+	}
+	var exportModelsFolder string
+	var dryRunOutput string
+	flag.StringVar(&exportModelsFolder, "exportModels", "",
+		"Export the Thing Models of the connected device families to the folder and exit")
+	flag.StringVar(&dryRunOutput, "dryRun", "",
+		"Write the TDs, property values and events as JSON lines to the file, or '-' for stdout, instead of publishing them")
+	// the hub configuration is optional in standalone and dry-run mode, which is checked below
+	hubConfig, hubErr := config.LoadAllConfig(os.Args, "", internal.PluginID, nil)
 	logging.SetLogging(hubConfig.Loglevel, hubConfig.LogFile)
+	if dryRunOutput == "-" {
+		// keep the log out of the JSON lines on stdout
+		logrus.SetOutput(os.Stderr)
+	}
+	substituteMap := newSubstituteMap(hubConfig)
+	configFile := path.Join(hubConfig.ConfigFolder, internal.PluginID+".yaml")
+	serviceConfig, err := internal.LoadConfigFile(configFile, substituteMap)
+	if os.IsNotExist(err) {
+		logrus.Infof("FYI The optional client configuration file %s is not present", configFile)
+		serviceConfig, err = internal.ParseConfig(nil, substituteMap)
+	}
 	if err != nil {
-		logrus.Errorf("%s: Failed to configure: %s", internal.PluginID, err)
+		logrus.Errorf("%s: Invalid configuration file '%s':\n%s", internal.PluginID, configFile, err)
 		os.Exit(1)
 	}
+	if hubErr != nil {
+		if serviceConfig.Standalone.BrokerURL == "" && dryRunOutput == "" {
+			logrus.Errorf("%s: Failed to configure: %s", internal.PluginID, hubErr)
+			os.Exit(1)
+		}
+		logrus.Infof("Hub configuration is not available. Running without the hub.")
+	}
+	if serviceConfig.StateFolder == "" {
+		serviceConfig.StateFolder = path.Join(hubConfig.HomeFolder, "data")
+	}
+	if serviceConfig.Zone == "" {
+		serviceConfig.Zone = hubConfig.Zone
+	}
+
+	if dryRunOutput != "" {
+		// don't interfere with the state and listen addresses of a running service
+		serviceConfig.StateFolder = ""
+		serviceConfig.PrometheusAddress = ""
+		serviceConfig.HealthAddress = ""
+	}
 
 	svc := internal.NewOWServerPB(serviceConfig,
 		hubConfig.Address, hubConfig.MqttPortCert, hubConfig.CaCert, hubConfig.PluginCert)
+	svc.SetConfigFile(configFile, substituteMap)
+
+	if exportModelsFolder != "" {
+		_, err = svc.ExportThingModels(exportModelsFolder)
+		if err != nil {
+			logrus.Errorf("%s: Failed to export Thing Models: %s", internal.PluginID, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	var dryRunFile *os.File
+	if dryRunOutput == "-" {
+		svc.SetThingFactory(dryrun.NewDryRunFactory(os.Stdout, internal.PropNameStatus))
+	} else if dryRunOutput != "" {
+		dryRunFile, err = os.Create(dryRunOutput)
+		if err != nil {
+			logrus.Errorf("%s: Failed to create the dry-run output: %s", internal.PluginID, err)
+			os.Exit(1)
+		}
+		svc.SetThingFactory(dryrun.NewDryRunFactory(dryRunFile, internal.PropNameStatus))
+	}
 
 	err = svc.Start()
 	if err != nil {
 		logrus.Errorf("%s: Failed to start: %s", internal.PluginID, err)
 		os.Exit(1)
 	}
-	proc.WaitForSignal()
+	waitForSignal()
 	svc.Stop()
+	if dryRunFile != nil {
+		_ = dryRunFile.Close()
+	}
 	os.Exit(0)
 }
@@ -32,6 +32,13 @@ func (pb *OWServerPB) HandleActionRequest(
 		return errors.New("Unknown action " + actionName)
 	}
 
+	err := ValidateWrite(&actionAffordance.Input, io.ValueAsString())
+	if err != nil {
+		logrus.Errorf("Rejected action '%s' of device '%s': %s", actionName, eThing.DeviceID, err)
+		pb.metrics.RecordWrite(err)
+		return err
+	}
+
 	// lookup the action name used by the EDS
 	edsName := eds.LookupEdsName(actionName)
 
@@ -41,7 +48,8 @@ func (pb *OWServerPB) HandleActionRequest(
 		actionValue = fmt.Sprint(io.ValueAsInt())
 	}
 
-	err := pb.edsAPI.WriteData(eThing.DeviceID, edsName, actionValue)
+	err = pb.edsAPI.WriteData(eThing.DeviceID, edsName, actionValue)
+	pb.metrics.RecordWrite(err)
 	if err == nil {
 		time.Sleep(time.Second)
 		err = pb.UpdatePropertyValues(true)
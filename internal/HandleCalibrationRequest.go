@@ -0,0 +1,95 @@
+// Package internal handles sensor calibration
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/calibration"
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// CalibrationPropName returns the name of the configuration property that holds the
+// calibration of a sensor, eg temperatureCalibration
+func CalibrationPropName(sensorName string) string {
+	return sensorName + "Calibration"
+}
+
+// IsCalibrated returns true if the attribute is a sensor that can be calibrated
+func IsCalibrated(attr eds.OneWireAttr) bool {
+	return attr.IsSensor && attr.DataType == vocab.WoTDataTypeNumber
+}
+
+// AddCalibrationAffordance adds a writable configuration property with the calibration
+// of a numeric sensor
+func AddCalibrationAffordance(tdoc *thing.ThingTD, attrName string, attr eds.OneWireAttr) {
+	if !IsCalibrated(attr) {
+		return
+	}
+	prop := tdoc.AddProperty(CalibrationPropName(attrName),
+		attr.Name+" calibration", vocab.WoTDataTypeObject)
+	prop.Description = "Calibration applied to the sensor value: " +
+		"value = (refLow + (raw-rawLow)*(refHigh-refLow)/(rawHigh-rawLow)) * gain + offset. " +
+		"The two-point calibration is only applied if rawLow and rawHigh differ."
+	prop.ReadOnly = false
+	prop.Properties = make(map[string]thing.PropertyAffordance)
+	for _, field := range []struct{ name, title, unit string }{
+		{name: "offset", title: "Offset", unit: attr.Unit},
+		{name: "gain", title: "Gain"},
+		{name: "rawLow", title: "Sensor reading at the low reference point", unit: attr.Unit},
+		{name: "rawHigh", title: "Sensor reading at the high reference point", unit: attr.Unit},
+		{name: "refLow", title: "Low reference value", unit: attr.Unit},
+		{name: "refHigh", title: "High reference value", unit: attr.Unit},
+	} {
+		prop.Properties[field.name] = thing.PropertyAffordance{DataSchema: thing.DataSchema{
+			Title: field.title, Type: vocab.WoTDataTypeNumber, Unit: field.unit}}
+	}
+}
+
+// ApplyCalibration returns the sensor attribute with its calibrated value
+// The calibration is applied to the raw value, before rounding it to the sensor decimals.
+func (pb *OWServerPB) ApplyCalibration(nodeID string, attrName string, attr eds.OneWireAttr) eds.OneWireAttr {
+	cal := pb.calibration.Get(nodeID, attrName)
+	if !IsCalibrated(attr) || cal.IsZero() {
+		return attr
+	}
+	rawValue, err := strconv.ParseFloat(attr.RawValue, 64)
+	if err != nil {
+		return attr
+	}
+	value := cal.Apply(rawValue)
+	if attr.Decimals >= 0 {
+		attr.Value = eds.FormatValue(value, attr.Decimals)
+	} else {
+		attr.Value = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return attr
+}
+
+// HandleCalibrationRequest handles the request to change the calibration of a sensor.
+// The new calibration is persisted and the sensor values are republished.
+func (pb *OWServerPB) HandleCalibrationRequest(
+	eThing *exposedthing.ExposedThing, propName string, io *thing.InteractionOutput) error {
+
+	logrus.Infof("Thing %s. propName=%s", eThing.GetThingDescription().GetID(), propName)
+	var cal calibration.Calibration
+	calJSON, _ := json.Marshal(io.ValueAsMap())
+	err := json.Unmarshal(calJSON, &cal)
+	if err != nil {
+		return fmt.Errorf("invalid calibration for '%s': %s", propName, err)
+	}
+	sensorName := propName[:len(propName)-len(CalibrationPropName(""))]
+	err = pb.calibration.Set(eThing.DeviceID, sensorName, cal)
+	if err != nil {
+		logrus.Errorf("Rejected calibration of '%s' of device '%s': %s", sensorName, eThing.DeviceID, err)
+		return err
+	}
+	_ = pb.calibration.Save()
+	return pb.UpdatePropertyValues(true)
+}
@@ -2,6 +2,8 @@
 package internal
 
 import (
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -16,13 +18,23 @@ import (
 func (pb *OWServerPB) HandleConfigRequest(
 	eThing *exposedthing.ExposedThing, propName string, io *thing.InteractionOutput) error {
 	logrus.Infof("Thing %s. propName=%s", eThing.GetThingDescription().GetID(), propName)
-	// for now accept all configuration
+	// reject values outside the range or enum of the property
+	propAffordance := eThing.GetThingDescription().GetProperty(propName)
+	if propAffordance != nil {
+		err := ValidateWrite(&propAffordance.DataSchema, io.ValueAsString())
+		if err != nil {
+			logrus.Errorf("Rejected write of '%s' of device '%s': %s", propName, eThing.DeviceID, err)
+			pb.metrics.RecordWrite(err)
+			return err
+		}
+	}
 
 	// If the property name is converted to a standardized vocabulary then convert the name
 	// to the EDS writable property name.
 	edsName := eds.LookupEdsName(propName)
 
 	err := pb.edsAPI.WriteData(eThing.DeviceID, edsName, io.ValueAsString())
+	pb.metrics.RecordWrite(err)
 	if err == nil {
 		time.Sleep(time.Second)
 		err = pb.UpdatePropertyValues(true)
@@ -34,3 +46,27 @@ func (pb *OWServerPB) HandleConfigRequest(
 	}
 	return err
 }
+
+// ValidateWrite checks a value against the range and enum of its schema
+// Values of schemas without range or enum are always valid.
+func ValidateWrite(schema *thing.DataSchema, value string) error {
+	if len(schema.Enum) > 0 {
+		for _, enumValue := range schema.Enum {
+			if fmt.Sprint(enumValue) == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("value '%s' is not one of %v", value, schema.Enum)
+	}
+	if schema.NumberMaximum > schema.NumberMinimum {
+		valueFloat, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("value '%s' is not a number", value)
+		}
+		if valueFloat < schema.NumberMinimum || valueFloat > schema.NumberMaximum {
+			return fmt.Errorf("value '%s' is outside the range %v to %v",
+				value, schema.NumberMinimum, schema.NumberMaximum)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// Package internal handles sensor history queries
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/history"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// ActionNameGetHistory is the name of the action to query the history of a device's sensors
+const ActionNameGetHistory = "getHistory"
+
+// EventNameHistory is the name of the event that carries the result of a history query
+const EventNameHistory = "history"
+
+// AddHistoryAffordances adds the history query action and result event to a TD
+func AddHistoryAffordances(tdoc *thing.ThingTD) {
+	actionAff := tdoc.AddAction(ActionNameGetHistory, "Get sensor history", vocab.WoTDataTypeObject)
+	actionAff.Description = "Query the history of sensor values. The result is sent with the '" +
+		EventNameHistory + "' event"
+	actionAff.Input.Properties = map[string]thing.DataSchema{
+		"from": {Title: "Start of the time range", Type: vocab.WoTDataTypeDateTime},
+		"to":   {Title: "End of the time range", Type: vocab.WoTDataTypeDateTime},
+		"name": {Title: "Sensor property name. Default is all sensors", Type: vocab.WoTDataTypeString},
+		"interval": {Title: "Downsampling interval", Type: vocab.WoTDataTypeInteger,
+			Unit: vocab.UnitNameSecond},
+	}
+	evAff := tdoc.AddEvent(EventNameHistory, "Sensor history", vocab.WoTDataTypeObject)
+	evAff.Description = "Result of the '" + ActionNameGetHistory + "' action"
+}
+
+// AddHistory adds a sensor value to the history of a node
+// Values that are not numeric are ignored.
+func (pb *OWServerPB) AddHistory(nodeID string, propName string, value string, timestamp time.Time) {
+	valueFloat, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		pb.history.Add(nodeID, propName, valueFloat, timestamp)
+	}
+}
+
+// HandleHistoryRequest handles the request to query the sensor history of a Thing.
+// The optional input parameters are 'from' and 'to' timestamps in RFC3339 format, the
+// sensor property 'name' and the downsampling 'interval' in seconds.
+// The result is emitted as the history event of the Thing.
+func (pb *OWServerPB) HandleHistoryRequest(
+	eThing *exposedthing.ExposedThing, actionName string, io *thing.InteractionOutput) error {
+
+	var from, to time.Time
+	var err error
+	params := io.ValueAsMap()
+	logrus.Infof("Thing %s. Action=%s params=%v",
+		eThing.GetThingDescription().GetID(), actionName, params)
+
+	if fromStr, ok := params["from"].(string); ok && fromStr != "" {
+		from, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			return fmt.Errorf("invalid 'from' time '%s': %s", fromStr, err)
+		}
+	}
+	if toStr, ok := params["to"].(string); ok && toStr != "" {
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			return fmt.Errorf("invalid 'to' time '%s': %s", toStr, err)
+		}
+	}
+	interval := time.Duration(0)
+	if intervalSec, ok := params["interval"].(float64); ok && intervalSec > 0 {
+		interval = time.Duration(intervalSec) * time.Second
+	}
+	names := pb.history.GetNames(eThing.DeviceID)
+	if name, ok := params["name"].(string); ok && name != "" {
+		names = []string{name}
+	}
+
+	samples := make(map[string][]history.Sample)
+	for _, name := range names {
+		samples[name] = pb.history.Query(eThing.DeviceID, name, from, to, interval)
+	}
+	result := map[string]interface{}{
+		"from":     params["from"],
+		"to":       params["to"],
+		"interval": interval.Seconds(),
+		"samples":  samples,
+	}
+	return eThing.EmitEvent(EventNameHistory, result)
+}
@@ -0,0 +1,92 @@
+// Package internal handles device metadata such as names and locations
+package internal
+
+import (
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/metadata"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// PropNameTags is the name of the property with the comma separated tags of a device
+const PropNameTags = "tags"
+
+// GetNodeMetadata returns the metadata of a node with the configured and runtime overrides applied
+// The node name and description are used if no title or description is set.
+func (pb *OWServerPB) GetNodeMetadata(node *eds.OneWireNode) metadata.DeviceMetadata {
+	nodeMetadata := metadata.DeviceMetadata{Title: node.Name, Description: node.Description}
+	return nodeMetadata.Merge(pb.metadata.Get(node.NodeID))
+}
+
+// AddMetadataAffordances adds the writable name and location properties and the read-only
+// tags property of a node. Properties that are already provided by the node are not added.
+func AddMetadataAffordances(tdoc *thing.ThingTD, node *eds.OneWireNode) {
+	if _, found := node.Attr[vocab.PropNameName]; !found {
+		prop := tdoc.AddProperty(vocab.PropNameName, "Name", vocab.WoTDataTypeString)
+		prop.Description = "Friendly name of the device"
+		prop.ReadOnly = false
+	}
+	if _, found := node.Attr[vocab.PropNameLocation]; !found {
+		prop := tdoc.AddProperty(vocab.PropNameLocation, "Location", vocab.WoTDataTypeString)
+		prop.Description = "Location or room of the device"
+		prop.ReadOnly = false
+	}
+	if _, found := node.Attr[PropNameTags]; !found {
+		prop := tdoc.AddProperty(PropNameTags, "Tags", vocab.WoTDataTypeString)
+		prop.Description = "Comma separated tags of the device"
+		prop.ReadOnly = true
+	}
+}
+
+// UpdateMetadataValues adds the metadata property values of a node
+func (pb *OWServerPB) UpdateMetadataValues(node *eds.OneWireNode, propValues map[string]interface{}) {
+	nodeMetadata := pb.GetNodeMetadata(node)
+	if _, found := node.Attr[vocab.PropNameName]; !found {
+		propValues[vocab.PropNameName] = nodeMetadata.Title
+	}
+	if _, found := node.Attr[vocab.PropNameLocation]; !found {
+		propValues[vocab.PropNameLocation] = nodeMetadata.Location
+	}
+	if _, found := node.Attr[PropNameTags]; !found {
+		propValues[PropNameTags] = strings.Join(nodeMetadata.Tags, ",")
+	}
+}
+
+// HandleMetadataRequest handles the request to change the name or location of a device.
+// The change is persisted and the TD of the device is republished with the new name.
+func (pb *OWServerPB) HandleMetadataRequest(
+	eThing *exposedthing.ExposedThing, propName string, io *thing.InteractionOutput) error {
+
+	logrus.Infof("Thing %s. propName=%s", eThing.GetThingDescription().GetID(), propName)
+	var update metadata.DeviceMetadata
+	switch propName {
+	case vocab.PropNameName:
+		update.Title = io.ValueAsString()
+	case vocab.PropNameLocation:
+		update.Location = io.ValueAsString()
+	}
+	pb.metadata.Update(eThing.DeviceID, update)
+	_ = pb.metadata.Save()
+
+	// The handler runs in the message bus callback, so republish the TD asynchronously
+	go pb.RepublishTD(eThing.DeviceID)
+	return nil
+}
+
+// RepublishTD republishes the TD of a node if it has changed, followed by all its property values.
+func (pb *OWServerPB) RepublishTD(deviceID string) {
+	pb.mu.Lock()
+	node, found := pb.nodeInfo[deviceID]
+	pb.mu.Unlock()
+	if !found {
+		logrus.Errorf("Device with ID %s is unknown", deviceID)
+		return
+	}
+	pb.CreateExposedThingFromNode(node)
+	_ = pb.UpdatePropertyValues(false)
+}
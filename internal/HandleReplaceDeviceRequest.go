@@ -0,0 +1,139 @@
+// Package internal handles replacement of devices
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/configfile"
+	"github.com/wostzone/owserver/internal/envconfig"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// ActionNameReplaceDevice is the name of the service action to replace a device
+const ActionNameReplaceDevice = "replaceDevice"
+
+// GetLogicalID returns the device ID used in the Thing ID of a node
+// This is the logical ID from the device metadata, or the ROM ID if no logical ID is set.
+func (pb *OWServerPB) GetLogicalID(romID string) string {
+	logicalID := pb.metadata.Get(romID).LogicalID
+	if logicalID == "" {
+		logicalID = romID
+	}
+	return logicalID
+}
+
+// AddReplaceDeviceAffordance adds the action to replace a device to the service TD
+func AddReplaceDeviceAffordance(tdoc *thing.ThingTD) {
+	actionAff := tdoc.AddAction(ActionNameReplaceDevice, "Replace device", vocab.WoTDataTypeObject)
+	actionAff.Description = "Move the Thing ID, metadata, calibration, counter scaling and counter " +
+		"totals of a replaced device to its replacement"
+	actionAff.Input.Properties = map[string]thing.DataSchema{
+		"oldID": {Title: "ROM ID of the replaced device", Type: vocab.WoTDataTypeString},
+		"newID": {Title: "ROM ID of the replacement device", Type: vocab.WoTDataTypeString},
+	}
+}
+
+// moveCounterConfig moves the scaling of the pulse counters of a replaced device to its
+// replacement and saves it in the configuration file.
+// This returns an error if the counters setting is set with an environment variable, as the
+// variable would restore the scaling of the replaced device on the next start.
+func (pb *OWServerPB) moveCounterConfig(oldRomID string, newRomID string) error {
+	pb.mu.Lock()
+	deviceCounters, found := pb.Config.Counters[oldRomID]
+	pb.mu.Unlock()
+	if !found {
+		return nil
+	}
+	varName := envconfig.EnvVarName(EnvPrefix, "counters")
+	if _, isSet := os.LookupEnv(varName); isSet {
+		return fmt.Errorf("the counter scaling of device '%s' is set with environment variable %s "+
+			"and can't be moved to '%s'", oldRomID, varName, newRomID)
+	}
+	// replace the map as the counter configuration is read without lock
+	pb.mu.Lock()
+	newCounters := make(map[string]map[string]CounterConfig, len(pb.Config.Counters))
+	for romID, counterConfigs := range pb.Config.Counters {
+		if romID != oldRomID {
+			newCounters[romID] = counterConfigs
+		}
+	}
+	newCounters[newRomID] = deviceCounters
+	pb.Config.Counters = newCounters
+	pb.mu.Unlock()
+	if pb.configFile == "" {
+		logrus.Warningf("No configuration file to save the counter scaling of device '%s' in", newRomID)
+		return nil
+	}
+	return configfile.UpdateConfigFile(pb.configFile, map[string]interface{}{"counters": newCounters})
+}
+
+// ReplaceDevice moves the logical ID, metadata, calibration, counter scaling and counter totals
+// of a replaced device to its replacement and republishes the TD of the replacement.
+// The counter scaling is saved in the configuration file.
+//  oldRomID is the ROM ID of the replaced device
+//  newRomID is the ROM ID of the replacement device
+func (pb *OWServerPB) ReplaceDevice(oldRomID string, newRomID string) error {
+	if oldRomID == "" || newRomID == "" || oldRomID == newRomID {
+		return fmt.Errorf("invalid device replacement from '%s' to '%s'", oldRomID, newRomID)
+	}
+	logrus.Warningf("Replacing device '%s' with '%s'", oldRomID, newRomID)
+	err := pb.moveCounterConfig(oldRomID, newRomID)
+	if err != nil {
+		return err
+	}
+	pb.metadata.Move(oldRomID, newRomID)
+	pb.calibration.Move(oldRomID, newRomID)
+	pb.counters.Move(oldRomID, newRomID)
+	_ = pb.metadata.Save()
+	_ = pb.calibration.Save()
+	_ = pb.counters.Save()
+
+	// The Thing ID moves to the replacement, so both exposed things are recreated. The replaced
+	// device is removed; it is added again if the gateway still reports it.
+	pb.RemoveNode(oldRomID)
+	pb.exposeMu.Lock()
+	pb.mu.Lock()
+	newNode, hasNewNode := pb.nodeInfo[newRomID]
+	newThing, hasNewThing := pb.eThings[newRomID]
+	delete(pb.eThings, newRomID)
+	delete(pb.tdFingerprints, newRomID)
+	aliasThing, hasAlias := pb.aliasThings[newRomID]
+	delete(pb.aliasThings, newRomID)
+	delete(pb.aliasFingerprints, newRomID)
+	pb.mu.Unlock()
+	if hasNewThing {
+		pb.eFactory.Destroy(newThing)
+	}
+	if hasAlias {
+		pb.eFactory.Destroy(aliasThing)
+	}
+	pb.exposeMu.Unlock()
+	if hasNewNode {
+		pb.CreateExposedThingFromNode(newNode)
+	}
+	return pb.UpdatePropertyValues(false)
+}
+
+// HandleReplaceDeviceRequest handles the service action to replace a device.
+// The input parameters are the 'oldID' and 'newID' ROM IDs.
+func (pb *OWServerPB) HandleReplaceDeviceRequest(
+	eThing *exposedthing.ExposedThing, actionName string, io *thing.InteractionOutput) error {
+
+	params := io.ValueAsMap()
+	logrus.Infof("Thing %s. Action=%s params=%v",
+		eThing.GetThingDescription().GetID(), actionName, params)
+	oldRomID, _ := params["oldID"].(string)
+	newRomID, _ := params["newID"].(string)
+
+	// The handler runs in the message bus callback, so recreate the exposed things asynchronously
+	go func() {
+		err := pb.ReplaceDevice(oldRomID, newRomID)
+		pb.EmitActionStatus(actionName, params, err)
+	}()
+	return nil
+}
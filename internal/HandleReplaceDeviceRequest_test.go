@@ -0,0 +1,67 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+// newRomID is the ROM ID of a replacement device that is not in the simulation file
+const newRomID = "C1001000002A0B7E"
+
+// startWithConfigFile starts a dry-run service with a counter scaling and a configuration file
+func startWithConfigFile(t *testing.T) (*internal.OWServerPB, string) {
+	configFile := path.Join(t.TempDir(), "owserver.yaml")
+	err := ioutil.WriteFile(configFile, []byte("# test configuration\nlogLevel: warning\n"), 0600)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.Counters = map[string]map[string]internal.CounterConfig{
+		counterRomID: {"counter1": {PulsesPerUnit: 1000, Unit: "kWh"}},
+	}
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	svc.SetThingFactory(dryrun.NewDryRunFactory(&dryRunOutput{}, internal.PropNameStatus))
+	svc.SetConfigFile(configFile, nil)
+	err = svc.Start()
+	require.NoError(t, err)
+	return svc, configFile
+}
+
+func TestReplaceDeviceMovesCounterConfig(t *testing.T) {
+	svc, configFile := startWithConfigFile(t)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+
+	err = svc.ReplaceDevice(counterRomID, newRomID)
+	require.NoError(t, err)
+	assert.Equal(t, 1000.0, svc.GetCounterConfig(newRomID, "counter1").PulsesPerUnit)
+	assert.Equal(t, "kWh", svc.GetCounterConfig(newRomID, "counter1").Unit)
+	assert.NotContains(t, svc.Config.Counters, counterRomID)
+
+	// the moved scaling is saved
+	savedConfig, err := internal.LoadConfigFile(configFile, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "warning", savedConfig.LogLevel)
+	assert.Equal(t, svc.Config.Counters, savedConfig.Counters)
+}
+
+func TestReplaceDeviceWithEnvCounterConfig(t *testing.T) {
+	svc, configFile := startWithConfigFile(t)
+	defer svc.Stop()
+	t.Setenv(internal.EnvPrefix+"COUNTERS", "{"+counterRomID+": {counter1: {pulsesPerUnit: 1000}}}")
+
+	// the environment variable would restore the scaling of the replaced device
+	err := svc.ReplaceDevice(counterRomID, newRomID)
+	assert.Error(t, err)
+	assert.Contains(t, svc.Config.Counters, counterRomID)
+	assert.NotContains(t, svc.Config.Counters, newRomID)
+	data, err := ioutil.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "counters")
+}
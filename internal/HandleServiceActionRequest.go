@@ -0,0 +1,221 @@
+// Package internal handles the maintenance actions of the service Thing
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Maintenance actions of the service Thing
+const (
+	ActionNameRediscover      = "rediscover"
+	ActionNameRefresh         = "refresh"
+	ActionNameRepublishTDs    = "republishTDs"
+	ActionNameResetStatistics = "resetStatistics"
+	ActionNameDumpSnapshot    = "dumpSnapshot"
+)
+
+// EventNameActionStatus is the name of the service event that reports the result of an action
+const EventNameActionStatus = "actionStatus"
+
+// Status of a completed action
+const (
+	ActionStatusCompleted = "completed"
+	ActionStatusFailed    = "failed"
+)
+
+// ActionStatus is the content of the action status event
+type ActionStatus struct {
+	// Action is the name of the action
+	Action string `json:"action"`
+	// Status is completed or failed
+	Status string `json:"status"`
+	// Message describes the result or the error
+	Message string `json:"message,omitempty"`
+	// Result of the action, if any
+	Result interface{} `json:"result,omitempty"`
+	// Timestamp the action ended
+	Timestamp string `json:"timestamp"`
+}
+
+// Snapshot of the nodes last parsed from the gateway
+type Snapshot struct {
+	// Timestamp the nodes were parsed
+	Timestamp string `json:"timestamp"`
+	// Nodes with their attributes, including the gateway
+	Nodes []*eds.OneWireNode `json:"nodes"`
+}
+
+// AddServiceActionAffordances adds the maintenance actions and the action status event to the service TD
+func AddServiceActionAffordances(tdoc *thing.ThingTD) {
+	actions := []struct{ name, title, description string }{
+		{ActionNameRediscover, "Rediscover gateway",
+			"Discover the gateway on the local network and use its address until the next restart"},
+		{ActionNameRefresh, "Refresh now", "Poll the gateway for its devices and values immediately"},
+		{ActionNameRepublishTDs, "Republish TDs", "Publish the TDs of the service and all devices"},
+		{ActionNameResetStatistics, "Reset statistics", "Clear the statistics of all sensors"},
+		{ActionNameDumpSnapshot, "Dump snapshot",
+			"Report the devices and attributes last parsed from the gateway"},
+	}
+	for _, action := range actions {
+		actionAff := tdoc.AddAction(action.name, action.title, "")
+		actionAff.Description = action.description + ". The result is sent with the '" +
+			EventNameActionStatus + "' event"
+	}
+	evAff := tdoc.AddEvent(EventNameActionStatus, "Action status", vocab.WoTDataTypeObject)
+	evAff.Description = "Result of an action of the service"
+	evAff.Data.Properties = map[string]thing.DataSchema{
+		"action": {Title: "Name of the action", Type: vocab.WoTDataTypeString},
+		"status": {Title: "Result status", Type: vocab.WoTDataTypeString,
+			Enum: []interface{}{ActionStatusCompleted, ActionStatusFailed}},
+		"message":   {Title: "Description of the result or error", Type: vocab.WoTDataTypeString},
+		"result":    {Title: "Result of the action", Type: vocab.WoTDataTypeObject},
+		"timestamp": {Title: "Time the action ended", Type: vocab.WoTDataTypeDateTime},
+	}
+}
+
+// UpdateSnapshot keeps the nodes last parsed from the gateway for the dumpSnapshot action
+func (pb *OWServerPB) UpdateSnapshot(nodeList []*eds.OneWireNode, timestamp time.Time) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	pb.snapshot = Snapshot{Timestamp: timestamp.Format(vocab.TimeFormat), Nodes: nodeList}
+}
+
+// Rediscover discovers the gateway on the local network and uses its address
+// The discovered address is not saved in the configuration.
+func (pb *OWServerPB) Rediscover() (address string, err error) {
+	address, err = pb.edsAPI.Discover()
+	if err != nil {
+		return "", fmt.Errorf("no gateway found: %s", err)
+	}
+	pb.edsAPI.SetAddress(address)
+	logrus.Warningf("Rediscovered gateway at '%s'", address)
+	return address, nil
+}
+
+// Refresh polls the gateway for its devices and values and publishes all values
+func (pb *OWServerPB) Refresh() error {
+	err := pb.UpdateExposedThings()
+	if err == nil {
+		err = pb.UpdatePropertyValues(false)
+	}
+	return err
+}
+
+// RepublishTDs publishes the TDs of the service and all devices, whether they have changed or not,
+// followed by all their property values.
+// This returns the number of published device TDs.
+func (pb *OWServerPB) RepublishTDs() (count int, err error) {
+	pb.mu.Lock()
+	for romID := range pb.tdFingerprints {
+		pb.tdFingerprints[romID] = ""
+	}
+	for romID := range pb.aliasFingerprints {
+		pb.aliasFingerprints[romID] = ""
+	}
+	serviceEThing := pb.serviceEThing
+	pb.mu.Unlock()
+
+	if serviceEThing != nil {
+		pb.exposeMu.Lock()
+		pb.eFactory.Destroy(serviceEThing)
+		pb.mu.Lock()
+		delete(pb.eThings, pb.Config.ClientID)
+		pb.mu.Unlock()
+		serviceEThing = pb.CreateExposedThingForService()
+		pb.mu.Lock()
+		pb.serviceEThing = serviceEThing
+		pb.mu.Unlock()
+		pb.exposeMu.Unlock()
+	}
+	err = pb.UpdateExposedThings()
+	if err != nil {
+		return 0, err
+	}
+	pb.mu.Lock()
+	count = len(pb.tdFingerprints)
+	pb.mu.Unlock()
+	err = pb.UpdatePropertyValues(false)
+	return count, err
+}
+
+// EmitActionStatus emits the result of a service action with the action status event
+func (pb *OWServerPB) EmitActionStatus(actionName string, result interface{}, err error) {
+	status := ActionStatus{
+		Action:    actionName,
+		Status:    ActionStatusCompleted,
+		Result:    result,
+		Timestamp: time.Now().Format(vocab.TimeFormat),
+	}
+	if err != nil {
+		status.Status = ActionStatusFailed
+		status.Message = err.Error()
+		logrus.Errorf("Action '%s' failed: %s", actionName, err)
+	}
+	pb.mu.Lock()
+	serviceEThing := pb.serviceEThing
+	pb.mu.Unlock()
+	if serviceEThing != nil {
+		_ = serviceEThing.EmitEvent(EventNameActionStatus, status)
+	}
+}
+
+// HandleServiceActionRequest handles the maintenance actions of the service
+// The actions run in the background and report their result with the action status event.
+func (pb *OWServerPB) HandleServiceActionRequest(
+	eThing *exposedthing.ExposedThing, actionName string, io *thing.InteractionOutput) error {
+
+	logrus.Infof("Thing %s. Action=%s", eThing.GetThingDescription().GetID(), actionName)
+	var action func() (interface{}, error)
+	switch actionName {
+	case ActionNameRediscover:
+		action = func() (interface{}, error) {
+			address, err := pb.Rediscover()
+			if err == nil {
+				err = pb.Refresh()
+			}
+			return map[string]string{"address": address}, err
+		}
+	case ActionNameRefresh:
+		action = func() (interface{}, error) {
+			return nil, pb.Refresh()
+		}
+	case ActionNameRepublishTDs:
+		action = func() (interface{}, error) {
+			count, err := pb.RepublishTDs()
+			return map[string]int{"things": count}, err
+		}
+	case ActionNameResetStatistics:
+		action = func() (interface{}, error) {
+			pb.stats.Reset()
+			logrus.Warning("Statistics have been reset")
+			return nil, nil
+		}
+	case ActionNameDumpSnapshot:
+		action = func() (interface{}, error) {
+			pb.mu.Lock()
+			defer pb.mu.Unlock()
+			if pb.snapshot.Nodes == nil {
+				return nil, fmt.Errorf("the gateway has not been read yet")
+			}
+			return pb.snapshot, nil
+		}
+	default:
+		err := fmt.Errorf("unknown action '%s'", actionName)
+		logrus.Error(err)
+		return err
+	}
+	// The handler runs in the message bus callback, so run the action asynchronously
+	go func() {
+		result, err := action()
+		pb.EmitActionStatus(actionName, result, err)
+	}()
+	return nil
+}
@@ -0,0 +1,100 @@
+package internal_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+// waitForActionStatus waits until the number of action status events is reached and returns the last one
+func waitForActionStatus(t *testing.T, out *dryRunOutput, count int) map[string]interface{} {
+	var statusEvents []dryrun.Message
+	require.Eventually(t, func() bool {
+		statusEvents = make([]dryrun.Message, 0)
+		for _, msg := range out.Messages(dryrun.MessageTypeEvent) {
+			if msg.Name == internal.EventNameActionStatus {
+				statusEvents = append(statusEvents, msg)
+			}
+		}
+		return len(statusEvents) >= count
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, statusEvents, count)
+	status, ok := statusEvents[count-1].Data.(map[string]interface{})
+	require.True(t, ok)
+	return status
+}
+
+func TestServiceActions(t *testing.T) {
+	// the gateway can't be read until the simulation file exists
+	simData, err := ioutil.ReadFile(strings.TrimPrefix(owsSimulationFile, "file://"))
+	require.NoError(t, err)
+	simFile := path.Join(t.TempDir(), "owserver-details.xml")
+	cfg := owsConfig
+	cfg.EdsAddress = "file://" + simFile
+	cfg.PublishTD = true
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+	td := thing.CreateTD(cfg.ClientID, "service", vocab.DeviceTypeService)
+	eThing := exposedthing.CreateExposedThing(cfg.ClientID, td)
+
+	err = svc.HandleServiceActionRequest(eThing, "unknown", nil)
+	assert.Error(t, err)
+
+	err = svc.HandleServiceActionRequest(eThing, internal.ActionNameDumpSnapshot, nil)
+	require.NoError(t, err)
+	status := waitForActionStatus(t, out, 1)
+	assert.Equal(t, internal.ActionNameDumpSnapshot, status["action"])
+	assert.Equal(t, internal.ActionStatusFailed, status["status"])
+	assert.Equal(t, "the gateway has not been read yet", status["message"])
+	assert.NotContains(t, status, "result")
+
+	err = ioutil.WriteFile(simFile, simData, 0600)
+	require.NoError(t, err)
+	err = svc.Refresh()
+	require.NoError(t, err)
+	err = svc.HandleServiceActionRequest(eThing, internal.ActionNameDumpSnapshot, nil)
+	require.NoError(t, err)
+	status = waitForActionStatus(t, out, 2)
+	assert.Equal(t, internal.ActionStatusCompleted, status["status"])
+	assert.NotContains(t, status, "message")
+	snapshot, _ := status["result"].(map[string]interface{})
+	require.NotNil(t, snapshot)
+	assert.NotEmpty(t, snapshot["timestamp"])
+	nodes, _ := snapshot["nodes"].([]interface{})
+	assert.Len(t, nodes, 4, "2 DS18B20, an EDS0068 and the gateway")
+}
+
+func TestEmitActionStatus(t *testing.T) {
+	cfg := owsConfig
+	cfg.PublishTD = true
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+
+	svc.EmitActionStatus(internal.ActionNameRepublishTDs, map[string]int{"things": 3}, nil)
+	status := waitForActionStatus(t, out, 1)
+	assert.Equal(t, internal.ActionNameRepublishTDs, status["action"])
+	assert.Equal(t, internal.ActionStatusCompleted, status["status"])
+	assert.Equal(t, map[string]interface{}{"things": 3.0}, status["result"])
+	assert.NotContains(t, status, "message")
+	_, err := time.Parse(vocab.TimeFormat, status["timestamp"].(string))
+	assert.NoError(t, err)
+
+	svc.EmitActionStatus(internal.ActionNameRefresh, nil, errors.New("gateway not reachable"))
+	status = waitForActionStatus(t, out, 2)
+	assert.Equal(t, internal.ActionNameRefresh, status["action"])
+	assert.Equal(t, internal.ActionStatusFailed, status["status"])
+	assert.Equal(t, "gateway not reachable", status["message"])
+	assert.NotContains(t, status, "result")
+}
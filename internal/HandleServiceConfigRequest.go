@@ -0,0 +1,244 @@
+// Package internal handles configuration changes of the service Thing
+package internal
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/configfile"
+	"github.com/wostzone/owserver/internal/deadband"
+	"github.com/wostzone/owserver/internal/envconfig"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Writable configuration properties of the service Thing
+const (
+	PropNameValueInterval = "valueInterval"
+	PropNameTDInterval    = "tdInterval"
+	PropNameLogLevel      = "logLevel"
+	PropNameDeadbands     = "deadbands"
+)
+
+// serviceConfigSettings are the names of the settings in the configuration file by the
+// name of the service property that changes them
+var serviceConfigSettings = map[string]string{
+	vocab.PropNameGatewayAddress: "owserverAddress",
+	PropNameValueInterval:        "valueInterval",
+	PropNameTDInterval:           "tdInterval",
+	PropNameLogLevel:             "logLevel",
+	PropNameDeadbands:            "deadbands",
+}
+
+// LogLevels that can be set
+var LogLevels = []interface{}{"error", "warning", "info", "debug"}
+
+// AddServiceConfigAffordances adds the writable configuration properties to the service TD
+func AddServiceConfigAffordances(tdoc *thing.ThingTD) {
+	prop := tdoc.AddProperty(vocab.PropNameGatewayAddress, "Gateway Address", vocab.WoTDataTypeString)
+	prop.Description = "Address of the OWServer gateway. Empty to auto discover the gateway."
+	prop.ReadOnly = false
+
+	prop = tdoc.AddProperty(PropNameValueInterval, "Value interval", vocab.WoTDataTypeInteger)
+	prop.Description = "Interval in seconds to poll the gateway for sensor values"
+	prop.Unit = vocab.UnitNameSecond
+	prop.NumberMinimum = 1
+	prop.NumberMaximum = 86400
+	prop.ReadOnly = false
+
+	prop = tdoc.AddProperty(PropNameTDInterval, "TD interval", vocab.WoTDataTypeInteger)
+	prop.Description = "Interval in seconds to poll the gateway for changes to its devices"
+	prop.Unit = vocab.UnitNameSecond
+	prop.NumberMinimum = 10
+	prop.NumberMaximum = 7 * 86400
+	prop.ReadOnly = false
+
+	prop = tdoc.AddProperty(PropNameLogLevel, "Log level", vocab.WoTDataTypeString)
+	prop.Description = "Logging level of the service"
+	prop.Enum = LogLevels
+	prop.ReadOnly = false
+
+	prop = tdoc.AddProperty(PropNameDeadbands, "Deadbands", vocab.WoTDataTypeString)
+	prop.Description = "Minimum change of sensor values to publish, by sensor property name, " +
+		"eg 'humidity=1,temperature=0.1'"
+	prop.ReadOnly = false
+}
+
+// GetServiceConfigValues returns the property values of the service Thing
+func (pb *OWServerPB) GetServiceConfigValues() map[string]interface{} {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	logLevel := logrus.GetLevel().String()
+	if logLevel == "warn" {
+		logLevel = "warning"
+	}
+	return map[string]interface{}{
+		vocab.PropNameGatewayAddress: pb.edsAPI.GetLastAddress(),
+		PropNameValueInterval:        pb.Config.ValueInterval,
+		PropNameTDInterval:           pb.Config.TDInterval,
+		PropNameLogLevel:             logLevel,
+		PropNameDeadbands:            deadband.FormatDeadbands(pb.deadbands.GetDeadbands()),
+	}
+}
+
+// SetLogLevel changes the logging level of the service
+//  levelName is one of error, warning, info or debug
+func SetLogLevel(levelName string) error {
+	level, err := ParseLogLevel(levelName)
+	if err != nil {
+		return err
+	}
+	logrus.SetLevel(level)
+	return nil
+}
+
+// ParseLogLevel returns the logging level with the given name
+//  levelName is one of error, warning, info or debug
+func ParseLogLevel(levelName string) (logrus.Level, error) {
+	level, err := logrus.ParseLevel(levelName)
+	if err != nil || level > logrus.DebugLevel || level < logrus.ErrorLevel {
+		return level, fmt.Errorf("log level '%s' is not one of %v", levelName, LogLevels)
+	}
+	return level, nil
+}
+
+// validateGatewayAddress checks that the gateway address is a host with optional port,
+// a file:// URL or empty.
+func validateGatewayAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	if strings.HasPrefix(address, "file://") {
+		_, err := url.Parse(address)
+		return err
+	}
+	host := address
+	if strings.Contains(address, ":") {
+		var err error
+		host, _, err = net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("gateway address '%s' is invalid: %s", address, err)
+		}
+	}
+	if host == "" || strings.ContainsAny(host, " /\t") {
+		return fmt.Errorf("gateway address '%s' is not a host name or IP address", address)
+	}
+	return nil
+}
+
+// SetServiceConfig validates and applies a change to the service configuration
+// The changed configuration must pass ValidateConfig, the same as a configuration file, so
+// a change that is accepted can be loaded again. The change takes effect immediately and is
+// saved in the configuration file.
+// Settings that are overridden with an environment variable can't be changed, as the
+// override would revert the change when the saved configuration file is reloaded.
+//  propName is the name of the service property to change
+//  value is the new value of the property
+func (pb *OWServerPB) SetServiceConfig(propName string, value string) (err error) {
+	setting, found := serviceConfigSettings[propName]
+	if !found {
+		return fmt.Errorf("property '%s' is not a configuration of the service", propName)
+	}
+	varName := envconfig.EnvVarName(EnvPrefix, setting)
+	if _, isSet := os.LookupEnv(varName); isSet {
+		return fmt.Errorf("'%s' is set with environment variable %s and can't be changed", propName, varName)
+	}
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	newConfig := pb.Config
+	var settingValue interface{}
+	var deadbands map[string]float64
+	switch propName {
+	case vocab.PropNameGatewayAddress:
+		newConfig.EdsAddress = value
+		settingValue = value
+	case PropNameValueInterval, PropNameTDInterval:
+		var interval int
+		interval, err = strconv.Atoi(value)
+		if err != nil || interval <= 0 {
+			return fmt.Errorf("%s '%s' is not a positive whole number of seconds", propName, value)
+		}
+		if propName == PropNameValueInterval {
+			newConfig.ValueInterval = interval
+		} else {
+			newConfig.TDInterval = interval
+		}
+		settingValue = interval
+	case PropNameLogLevel:
+		newConfig.LogLevel = value
+		settingValue = value
+	case PropNameDeadbands:
+		deadbands, err = deadband.ParseDeadbands(value)
+		if err != nil {
+			return err
+		}
+		newConfig.Deadbands = deadbands
+		settingValue = deadbands
+	}
+	err = ValidateConfig(newConfig).Err()
+	if err != nil {
+		return err
+	}
+
+	switch propName {
+	case vocab.PropNameGatewayAddress:
+		pb.edsAPI.SetAddress(value)
+	case PropNameLogLevel:
+		err = SetLogLevel(value)
+	case PropNameDeadbands:
+		err = pb.deadbands.SetDeadbands(deadbands)
+	}
+	if err != nil {
+		return err
+	}
+	pb.Config = newConfig
+	logrus.Warningf("Service configuration '%s' changed to '%s'", propName, value)
+	if pb.configFile != "" {
+		err = configfile.UpdateConfigFile(pb.configFile, map[string]interface{}{setting: settingValue})
+	}
+	return err
+}
+
+// HandleServiceConfigRequest handles requests to change the configuration of the service
+// Values outside the range or enum of the property are rejected. A new gateway address
+// triggers a poll of the gateway.
+func (pb *OWServerPB) HandleServiceConfigRequest(
+	eThing *exposedthing.ExposedThing, propName string, io *thing.InteractionOutput) error {
+
+	value := fmt.Sprint(io.Value)
+	if io.Value == nil {
+		value = ""
+	}
+	logrus.Infof("Thing %s. propName=%s value=%s", eThing.GetThingDescription().GetID(), propName, value)
+	propAffordance := eThing.GetThingDescription().GetProperty(propName)
+	if propAffordance == nil || propAffordance.ReadOnly {
+		err := fmt.Errorf("property '%s' of the service is not writable", propName)
+		logrus.Error(err)
+		return err
+	}
+	err := ValidateWrite(&propAffordance.DataSchema, value)
+	if err == nil {
+		err = pb.SetServiceConfig(propName, value)
+	}
+	if err != nil {
+		logrus.Errorf("Rejected write of '%s' of the service: %s", propName, err)
+		return err
+	}
+	_ = eThing.EmitPropertyChange(propName, pb.GetServiceConfigValues()[propName], false)
+
+	if propName == vocab.PropNameGatewayAddress {
+		// the handler runs in the message bus callback, so poll the new gateway asynchronously
+		go func() {
+			_ = pb.UpdateExposedThings()
+			_ = pb.UpdatePropertyValues(false)
+		}()
+	}
+	return nil
+}
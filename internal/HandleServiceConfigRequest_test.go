@@ -0,0 +1,65 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+)
+
+func TestServiceWriteIntervals(t *testing.T) {
+	svc, configFile := startWithConfigFile(t)
+	defer svc.Stop()
+	err := svc.SetServiceConfig(internal.PropNameValueInterval, "30")
+	require.NoError(t, err)
+	err = svc.SetServiceConfig(internal.PropNameTDInterval, "60")
+	require.NoError(t, err)
+
+	// the TD interval can't be shorter than the value interval
+	err = svc.SetServiceConfig(internal.PropNameTDInterval, "10")
+	assert.Error(t, err)
+	assert.Equal(t, 60, svc.Config.TDInterval)
+	err = svc.SetServiceConfig(internal.PropNameValueInterval, "90")
+	assert.Error(t, err)
+	assert.Equal(t, 30, svc.Config.ValueInterval)
+
+	// the rejected writes are not saved
+	savedConfig, err := internal.LoadConfigFile(configFile, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 30, savedConfig.ValueInterval)
+	assert.Equal(t, 60, savedConfig.TDInterval)
+}
+
+func TestServiceWriteSavesValidConfig(t *testing.T) {
+	logLevel := logrus.GetLevel()
+	defer logrus.SetLevel(logLevel)
+	svc, configFile := startWithConfigFile(t)
+	defer svc.Stop()
+	writes := []struct{ propName, value string }{
+		{vocab.PropNameGatewayAddress, owsSimulationFile},
+		{internal.PropNameValueInterval, "20"},
+		{internal.PropNameTDInterval, "300"},
+		{internal.PropNameLogLevel, "info"},
+		{internal.PropNameDeadbands, "humidity=1,temperature=0.1"},
+	}
+	for _, write := range writes {
+		err := svc.SetServiceConfig(write.propName, write.value)
+		require.NoError(t, err, write.propName)
+
+		// the saved file passes the same validation as at startup
+		savedConfig, err := internal.LoadConfigFile(configFile, nil)
+		require.NoError(t, err, write.propName)
+		assert.Empty(t, internal.ValidateConfig(savedConfig), write.propName)
+	}
+	savedConfig, err := internal.LoadConfigFile(configFile, nil)
+	require.NoError(t, err)
+	assert.Equal(t, owsSimulationFile, savedConfig.EdsAddress)
+	assert.Equal(t, 20, savedConfig.ValueInterval)
+	assert.Equal(t, 300, savedConfig.TDInterval)
+	assert.Equal(t, "info", savedConfig.LogLevel)
+	assert.Equal(t, map[string]float64{"humidity": 1, "temperature": 0.1}, savedConfig.Deadbands)
+}
@@ -0,0 +1,90 @@
+// Package internal loads the service configuration from file, environment and secret files
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/wostzone/wost-go/pkg/config"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wostzone/owserver/internal/configcheck"
+	"github.com/wostzone/owserver/internal/envconfig"
+	"github.com/wostzone/owserver/internal/redact"
+)
+
+// EnvPrefix is the prefix of the environment variables that override the configuration, eg
+// OWSERVER_PASSWORD or OWSERVER_VALUE_INTERVAL
+const EnvPrefix = "OWSERVER_"
+
+// readPasswordFile reads a password from a password file, if set
+// Trailing newlines are removed.
+//  path of the password file setting, used to report problems
+//  passwordFile is the file to read, "" to keep the password
+//  password to replace
+func readPasswordFile(problems *configcheck.Problems, path string, passwordFile string, password *string) {
+	if passwordFile == "" {
+		return
+	}
+	if *password != "" {
+		problems.Add(path, "set either password or passwordFile, not both")
+		return
+	}
+	data, err := ioutil.ReadFile(passwordFile)
+	if err != nil {
+		problems.Add(path, "password file can't be read: %s", err)
+		return
+	}
+	*password = strings.TrimRight(string(data), "\r\n")
+}
+
+// loadPasswordFile reads the gateway and standalone broker passwords from their password files
+func loadPasswordFile(cfg *OWServerPBConfig, problems *configcheck.Problems) {
+	readPasswordFile(problems, "passwordFile", cfg.PasswordFile, &cfg.Password)
+	readPasswordFile(problems, "standalone.passwordFile", cfg.Standalone.PasswordFile, &cfg.Standalone.Password)
+}
+
+// ParseConfig parses and validates the service configuration
+// Environment variables named by envconfig.EnvVarName with the EnvPrefix override the settings
+// in the document and the passwords are read from their passwordFile if set. The passwords
+// are registered as secrets that are redacted from the log.
+//  data is the YAML document with the configuration, nil to use the environment only
+//  substituteMap with the template keywords to substitute, eg {homeFolder}. nil to ignore.
+// This returns the configuration and a configcheck.Problems error if it has problems.
+func ParseConfig(data []byte, substituteMap map[string]string) (cfg OWServerPBConfig, err error) {
+	text := string(data)
+	if substituteMap != nil {
+		text = config.SubstituteText(text, substituteMap)
+	}
+	problems, err := configcheck.FindUnknownKeys([]byte(text), cfg)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.Unmarshal([]byte(text), &cfg)
+	if err != nil {
+		return cfg, err
+	}
+	_, envProblems := envconfig.ApplyEnv(&cfg, EnvPrefix, os.LookupEnv)
+	problems = append(problems, envProblems...)
+	loadPasswordFile(&cfg, &problems)
+	redact.AddSecret(cfg.Password)
+	redact.AddSecret(cfg.Standalone.Password)
+
+	problems = append(problems, ValidateConfig(cfg)...)
+	return cfg, problems.Err()
+}
+
+// LoadConfigFile loads and validates the service configuration file
+// Unknown settings, such as misspelled names, and invalid values are reported as problems.
+// See ParseConfig for the environment variables and password file.
+//  filename of the configuration file
+//  substituteMap with the template keywords to substitute, eg {homeFolder}. nil to ignore.
+// This returns the configuration and a configcheck.Problems error if the file has problems.
+func LoadConfigFile(filename string, substituteMap map[string]string) (cfg OWServerPBConfig, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	return ParseConfig(data, substituteMap)
+}
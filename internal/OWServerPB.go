@@ -3,18 +3,35 @@ package internal
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"net/http"
+	"os"
+	"path"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
 
+	"github.com/wostzone/owserver/internal/calibration"
+	"github.com/wostzone/owserver/internal/counters"
+	"github.com/wostzone/owserver/internal/deadband"
 	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/filters"
+	"github.com/wostzone/owserver/internal/history"
+	"github.com/wostzone/owserver/internal/inventory"
+	"github.com/wostzone/owserver/internal/metadata"
+	"github.com/wostzone/owserver/internal/metrics"
+	"github.com/wostzone/owserver/internal/mqttfactory"
+	"github.com/wostzone/owserver/internal/redact"
+	"github.com/wostzone/owserver/internal/sdnotify"
+	"github.com/wostzone/owserver/internal/stats"
+	"github.com/wostzone/owserver/internal/validation"
 )
 
 // PluginID is the default ID of this service. Used to name the configuration file
-// and as the publisher ID portion of the Thing ID (zoneID:publisherID:deviceID:deviceType)
+// and as the default publisher ID portion of the Thing ID (zoneID:publisherID:deviceID:deviceType)
 const PluginID = "owserver"
 
 // OWServerPBConfig contains the plugin configuration
@@ -22,11 +39,22 @@ type OWServerPBConfig struct {
 	// The service instance ID, default is the pluginID
 	// Must be unique on the hub. Recommended is to add a '-1' in case of multiple instances.
 	ClientID string `yaml:"clientID"`
+	// Zone of the published Things, default is the hub zone, or 'local' if not set.
+	Zone string `yaml:"zone,omitempty"`
+	// LegacyThingIDs also publishes the devices under the Thing IDs of previous versions, which
+	// didn't include the zone and service instance ID, as deprecated aliases. Default is False.
+	LegacyThingIDs bool `yaml:"legacyThingIDs,omitempty"`
+	// LegacyThingIDsUntil is the last date, as YYYY-MM-DD, to publish the legacy Thing IDs.
+	// Default is no end date.
+	LegacyThingIDsUntil string `yaml:"legacyThingIDsUntil,omitempty"`
 	// OWServer address. Default is auto-discover using DNS-SD
 	EdsAddress string `yaml:"owserverAddress,omitempty"`
 	// Login to the EDS OWserver using Basic Auth.
 	LoginName string `yaml:"loginName,omitempty"`
 	Password  string `yaml:"password,omitempty"`
+	// PasswordFile is the file to read the login password from instead of the password setting,
+	// eg a docker secret or systemd credential. Default is none.
+	PasswordFile string `yaml:"passwordFile,omitempty"`
 	// PrettyJSON for testing to improve readability of JSON output, default is False
 	PrettyJSON bool `yaml:"prettyJSON,omitempty"`
 	// PublishTD enables publish the TD of this service, default is False
@@ -35,6 +63,84 @@ type OWServerPBConfig struct {
 	TDInterval int `yaml:"tdInterval,omitempty"`
 	// interval of republishing modified Thing property values, default is 60 seconds
 	ValueInterval int `yaml:"valueInterval,omitempty"`
+	// interval of publishing the service metrics, default is 60 seconds
+	MetricsInterval int `yaml:"metricsInterval,omitempty"`
+	// PrometheusAddress is the local address to serve the metrics for Prometheus on, eg
+	// "127.0.0.1:9110". Default is disabled.
+	PrometheusAddress string `yaml:"prometheusAddress,omitempty"`
+	// PrometheusSensors includes the sensor values in the Prometheus metrics, default is False
+	PrometheusSensors bool `yaml:"prometheusSensors,omitempty"`
+	// HealthAddress is the local address to serve the /healthz and /readyz endpoints on, eg
+	// "127.0.0.1:9111". This can be the same address as the PrometheusAddress. Default is disabled.
+	HealthAddress string `yaml:"healthAddress,omitempty"`
+	// ReadyIntervals is the number of value intervals since the last successful poll of the
+	// gateway after which the service is no longer ready, default is 3
+	ReadyIntervals int `yaml:"readyIntervals,omitempty"`
+	// StaleNodeExpiry is the time in seconds after which a node that the gateway no longer
+	// reports is removed from the inventory and its Thing is destroyed, default is 1 day
+	StaleNodeExpiry int `yaml:"staleNodeExpiry,omitempty"`
+	// StateFolder is the folder where state files are stored. Default is the 'data' folder in the hub home.
+	StateFolder string `yaml:"stateFolder,omitempty"`
+	// HistorySize is the maximum number of samples kept per sensor, default is 1000
+	HistorySize int `yaml:"historySize,omitempty"`
+	// HistoryDuration is the maximum age in seconds of samples kept in the history, default is 24 hours
+	HistoryDuration int `yaml:"historyDuration,omitempty"`
+	// PersistHistory saves the history in the state folder to retain it after a restart, default is False
+	PersistHistory bool `yaml:"persistHistory,omitempty"`
+	// StatisticsWindows are the windows to collect sensor minimum, maximum and average over,
+	// eg "1h" or "today". Default is none.
+	StatisticsWindows []string `yaml:"statisticsWindows,omitempty"`
+	// Timezone used to align statistics windows to midnight, eg "Europe/Amsterdam". Default is local time.
+	Timezone string `yaml:"timezone,omitempty"`
+	// Counters with the scaling of pulse counters by ROM ID and counter name, eg counter1
+	Counters map[string]map[string]CounterConfig `yaml:"counters,omitempty"`
+	// DerivedValues computes dew point, humidex, heat index and absolute humidity for devices
+	// that report temperature and humidity but not these values, default is False
+	DerivedValues bool `yaml:"derivedValues,omitempty"`
+	// Altitude of the sensors in meters, used to compute the sea level pressure from the
+	// barometric pressure when DerivedValues is enabled. Default is 0, which disables it.
+	Altitude float64 `yaml:"altitude,omitempty"`
+	// Calibration of sensors by ROM ID and property name, eg temperature.
+	// Calibrations changed through the Thing's configuration are persisted and override these.
+	Calibration map[string]map[string]calibration.Calibration `yaml:"calibration,omitempty"`
+	// Validation with the plausible ranges and sentinel values of sensors in addition to the
+	// default rules. Rejected readings are replaced with the last good value.
+	Validation ValidationConfig `yaml:"validation,omitempty"`
+	// Filters with the smoothing filters of noisy sensors. Default is no filtering.
+	Filters FiltersConfig `yaml:"filters,omitempty"`
+	// Deadbands by sensor property name, eg temperature. Sensor values are only published when
+	// they differ by at least the deadband from the last published value. Default is none.
+	Deadbands map[string]float64 `yaml:"deadbands,omitempty"`
+	// LogLevel of this service: error, warning, info or debug. Default is the hub log level.
+	LogLevel string `yaml:"logLevel,omitempty"`
+	// Devices with the logical ID, title, description, location and tags of devices by ROM ID.
+	// The logical ID replaces the ROM ID in the Thing ID so it survives replacement of the device.
+	// Names and locations changed through the Thing's properties are persisted and override these.
+	Devices map[string]metadata.DeviceMetadata `yaml:"devices,omitempty"`
+	// Standalone runs the service without the hub using its own MQTT broker connection.
+	// Standalone mode is enabled when its brokerURL is set. Default is to run as a hub plugin.
+	Standalone mqttfactory.Config `yaml:"standalone,omitempty"`
+}
+
+// ThingFactory creates the exposed things and publishes them on the message bus
+// This is implemented by the hub exposed thing factory, the standalone MQTT factory and the
+// dry-run factory.
+type ThingFactory interface {
+	// Connect to the message bus
+	Connect(address string, port int) error
+	// Disconnect from the message bus
+	Disconnect()
+	// Expose creates an exposed thing and publishes its TD. This returns true if it already exists.
+	Expose(deviceID string, td *thing.ThingTD) (*exposedthing.ExposedThing, bool)
+	// Destroy stops serving the exposed thing and removes it
+	Destroy(eThing *exposedthing.ExposedThing)
+}
+
+// ConnectionStatus is implemented by Thing factories that report the state of their
+// connection to the message bus
+type ConnectionStatus interface {
+	// IsConnected returns true while connected to the message bus
+	IsConnected() bool
 }
 
 // OWServerPB is the hub protocol binding plugin for capturing 1-wire OWServer V2 Data
@@ -51,7 +157,8 @@ type OWServerPB struct {
 	// Client certificate of this service
 	pluginCert *tls.Certificate
 
-	// Hub MQTT broker address and port to use for publishing TD and events
+	// MQTT broker address and port to use for publishing TD and events. This is the hub broker
+	// unless the service runs standalone.
 	mqttAddress string
 	mqttPort    int
 
@@ -62,18 +169,87 @@ type OWServerPB struct {
 	// map of node/device ID to node info
 	nodeInfo map[string]*eds.OneWireNode
 
+	// History of sensor values of each node
+	history *history.HistoryStore
+
+	// Statistics of sensor values of each node
+	stats *stats.StatsStore
+
+	// Totals of pulse counters of each node
+	counters *counters.CounterStore
+
+	// Calibration of sensors of each node
+	calibration *calibration.CalibrationStore
+
+	// Validation of sensor readings of each node
+	validator *validation.Validator
+
+	// Smoothing filters of sensors of each node
+	filters *filters.FilterStore
+
+	// Deadbands of sensors of each node
+	deadbands *deadband.DeadbandStore
+
+	// User provided metadata of each node
+	metadata *metadata.MetadataStore
+
+	// Last known nodes and values, to publish Things while the gateway cannot be reached
+	inventory *inventory.InventoryStore
+
+	// Configuration file to persist configuration changes in. "" to not persist.
+	configFile string
+
+	// Template keywords to substitute when reloading the configuration file
+	configSubstitutes map[string]string
+
+	// Log level before the configured log level was applied
+	defaultLogLevel logrus.Level
+
 	// Factory for creating exposed things
-	eFactory *exposedthing.ExposedThingFactory
+	eFactory ThingFactory
+
+	// exposeMu serializes exposing and destroying the exposed things of nodes, which is done
+	// by the heartbeat, configuration changes and service actions
+	exposeMu sync.Mutex
 
 	// Map of node/device ID to exposed thing created for each published node
 	eThings map[string]*exposedthing.ExposedThing
 
+	// Map of node/device ID to the fingerprint of the TD of its exposed thing
+	tdFingerprints map[string]string
+
+	// Map of node/device ID to the exposed thing published under its legacy Thing ID
+	aliasThings map[string]*exposedthing.ExposedThing
+
+	// Map of node/device ID to the fingerprint of the TD of its legacy exposed thing
+	aliasFingerprints map[string]string
+
+	// Last date the legacy Thing IDs are published. Zero if there is no end date.
+	legacyIDsUntil time.Time
+
+	// Topology of the gateway and its devices
+	topology Topology
+
+	// Nodes last parsed from the gateway
+	snapshot Snapshot
+
+	// Health and performance metrics of the service
+	metrics *metrics.Metrics
+
+	// HTTP servers of the metrics and health endpoints. Empty if disabled
+	httpServers []*http.Server
+
+	// Time of the last heartbeat, to detect a hung heartbeat
+	lastHeartbeat time.Time
+
 	// exposed thing of the service itself. nil if disabled
 	serviceEThing *exposedthing.ExposedThing
 
 	// flag, this service is up and running
 	running bool
-	mu      sync.Mutex
+	// flag, the Thing factory connected to the message bus on start
+	busConnected bool
+	mu           sync.Mutex
 
 	// the zone of the plugin publications, default is local
 	zone string
@@ -83,10 +259,15 @@ type OWServerPB struct {
 // This:
 //   1. connects to the hub message bus
 //   2. publish this service as a Thing as its own publisher
-//   3. periodic poll the OWServer gateway for metadata and values of 1-wire devices
+//   3. publish the Things of the nodes known from the previous session with their last values
+//   4. serve the metrics for Prometheus and the health endpoints, if enabled
+//   5. watch the configuration file for changes and apply them
+//   6. periodic poll the OWServer gateway for metadata and values of 1-wire devices
 //   	a. create a TD and an exposed thing for each 1-wire device connected to the OWServer gateway
 //      b. expose (publish) the TD of newly added or modified exposed things
 //      c. publish the values of 1-wire devices via the exposed thing
+//   7. notify systemd that the service is ready after the first successful readiness check,
+//      if run by systemd
 func (pb *OWServerPB) Start() error {
 	var err error
 
@@ -96,15 +277,45 @@ func (pb *OWServerPB) Start() error {
 		return err
 	}
 
+	pb.defaultLogLevel = logrus.GetLevel()
+	if pb.Config.LogLevel != "" {
+		_ = SetLogLevel(pb.Config.LogLevel)
+	}
+	if pb.Config.StateFolder != "" {
+		_ = os.MkdirAll(pb.Config.StateFolder, 0700)
+	}
+	// Restore the sensor history, counter totals, calibrations, device metadata and node inventory
+	// from the previous session
+	_ = pb.history.Load()
+	_ = pb.counters.Load()
+	_ = pb.calibration.Load()
+	_ = pb.metadata.Load()
+	_ = pb.inventory.Load()
+
 	// Publish the OWServer service as a Thing
 	if pb.Config.PublishTD {
 		pb.serviceEThing = pb.CreateExposedThingForService()
 	}
 
+	// Publish the last known nodes until the gateway answers
+	pb.ExposeInventory()
+
+	// Serve the metrics for Prometheus and the health endpoints, if enabled
+	_ = pb.StartHTTPServers()
+
 	// Periodic polling of the OWServer
+	pb.mu.Lock()
 	pb.running = true
+	pb.busConnected = true
+	pb.lastHeartbeat = time.Now()
+	pb.mu.Unlock()
 	go pb.heartBeat()
 
+	// Reload the configuration when the file changes
+	if pb.configFile != "" {
+		go pb.watchConfigFile()
+	}
+
 	logrus.Infof("Service OWServer startup completed")
 	return nil
 }
@@ -115,41 +326,158 @@ func (pb *OWServerPB) Stop() {
 	defer pb.mu.Unlock()
 	if pb.running {
 		pb.running = false
+		pb.busConnected = false
 
 		logrus.Info("Stopping service OWServer")
+		NotifySystemd(sdnotify.StateStopping)
 		// FIXME, wait until discovery has completed if running
 		time.Sleep(time.Second)
 
+		_ = pb.history.Save()
+		_ = pb.counters.Save()
+		_ = pb.inventory.Save()
+		pb.StopHTTPServers()
 		pb.eFactory.Disconnect()
 	}
 }
 
+// SetConfigFile sets the configuration file to persist configuration changes in and to
+// reload the configuration from when it changes.
+// Changes made through the service Thing are not persisted if no file is set.
+//  filename is the configuration file
+//  substituteMap with the template keywords to substitute when reloading, eg {homeFolder}. nil to ignore.
+func (pb *OWServerPB) SetConfigFile(filename string, substituteMap map[string]string) {
+	pb.configFile = filename
+	pb.configSubstitutes = substituteMap
+}
+
+// SetThingFactory replaces the factory that exposes the Things, eg to write them to a file
+// instead of publishing them. This must be called before Start.
+func (pb *OWServerPB) SetThingFactory(factory ThingFactory) {
+	pb.eFactory = factory
+}
+
+// SetConfigDefaults replaces the settings that are not set with their default
+func SetConfigDefaults(config *OWServerPBConfig) {
+	if config.ClientID == "" {
+		config.ClientID = PluginID
+	}
+	if config.TDInterval == 0 {
+		config.TDInterval = 3600
+	}
+	if config.ValueInterval == 0 {
+		config.ValueInterval = 30
+	}
+	if config.MetricsInterval == 0 {
+		config.MetricsInterval = 60
+	}
+	if config.ReadyIntervals == 0 {
+		config.ReadyIntervals = 3
+	}
+	if config.StaleNodeExpiry == 0 {
+		config.StaleNodeExpiry = 24 * 3600
+	}
+	if config.HistorySize == 0 {
+		config.HistorySize = 1000
+	}
+	if config.HistoryDuration == 0 {
+		config.HistoryDuration = 24 * 3600
+	}
+}
+
 // NewOWServerPB creates a new OWServer Protocol Binding service with the provided configuration
+// The hub MQTT address, port and certificates are not used when the configuration enables
+// standalone mode.
 func NewOWServerPB(config OWServerPBConfig, mqttAddress string, mqttPort int,
 	caCert *x509.Certificate, pluginCert *tls.Certificate) *OWServerPB {
 
 	// these are from hub configuration
 	pb := &OWServerPB{
-		mqttAddress: mqttAddress,
-		mqttPort:    mqttPort,
-		caCert:      caCert,
-		pluginCert:  pluginCert,
-		nodeInfo:    make(map[string]*eds.OneWireNode),
-		eThings:     make(map[string]*exposedthing.ExposedThing),
-		eFactory:    exposedthing.CreateExposedThingFactory(config.ClientID, pluginCert, caCert),
-		running:     false,
+		mqttAddress:       mqttAddress,
+		mqttPort:          mqttPort,
+		caCert:            caCert,
+		pluginCert:        pluginCert,
+		nodeInfo:          make(map[string]*eds.OneWireNode),
+		eThings:           make(map[string]*exposedthing.ExposedThing),
+		tdFingerprints:    make(map[string]string),
+		aliasThings:       make(map[string]*exposedthing.ExposedThing),
+		aliasFingerprints: make(map[string]string),
+		running:           false,
 	}
 	pb.Config = config
-	// ensure valid defaults
-	if pb.Config.ClientID == "" {
-		pb.Config.ClientID = PluginID
+	SetConfigDefaults(&pb.Config)
+	redact.AddSecret(pb.Config.Password)
+	redact.AddSecret(pb.Config.Standalone.Password)
+	if pb.Config.Standalone.BrokerURL != "" {
+		host, port, _, err := mqttfactory.ParseBrokerURL(pb.Config.Standalone.BrokerURL)
+		if err != nil {
+			logrus.Errorf("Invalid standalone broker URL: %s", err)
+		}
+		pb.mqttAddress = host
+		pb.mqttPort = port
+		pb.eFactory = mqttfactory.NewMqttFactory(pb.Config.ClientID, pb.Config.Standalone)
+		logrus.Infof("Running standalone with broker '%s'", pb.Config.Standalone.BrokerURL)
+	} else {
+		pb.eFactory = exposedthing.CreateExposedThingFactory(pb.Config.ClientID, pluginCert, caCert)
 	}
-	if pb.Config.TDInterval == 0 {
-		pb.Config.TDInterval = 3600
+	pb.zone = pb.Config.Zone
+	if pb.zone == "" {
+		pb.zone = "local"
 	}
-	if pb.Config.ValueInterval == 0 {
-		pb.Config.ValueInterval = 30
+	if pb.Config.LegacyThingIDsUntil != "" {
+		until, err := time.ParseInLocation("2006-01-02", pb.Config.LegacyThingIDsUntil, time.Local)
+		if err != nil {
+			logrus.Errorf("Invalid legacyThingIDsUntil date '%s', ignoring it: %s",
+				pb.Config.LegacyThingIDsUntil, err)
+		} else {
+			pb.legacyIDsUntil = until
+		}
+	}
+	historyFile := ""
+	if pb.Config.PersistHistory && pb.Config.StateFolder != "" {
+		historyFile = path.Join(pb.Config.StateFolder, pb.Config.ClientID+"-history.json")
+	}
+	pb.history = history.NewHistoryStore(pb.Config.HistorySize,
+		time.Duration(pb.Config.HistoryDuration)*time.Second, historyFile)
+
+	windows := make([]stats.Window, 0, len(pb.Config.StatisticsWindows))
+	for _, windowName := range pb.Config.StatisticsWindows {
+		window, err := stats.ParseWindow(windowName)
+		if err != nil {
+			logrus.Errorf("Ignoring statistics window: %s", err)
+			continue
+		}
+		windows = append(windows, window)
+	}
+	location := time.Local
+	if pb.Config.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(pb.Config.Timezone)
+		if err != nil {
+			logrus.Errorf("Invalid timezone '%s', using local time: %s", pb.Config.Timezone, err)
+			location = time.Local
+		}
+	}
+	pb.stats = stats.NewStatsStore(windows, location)
+
+	countersFile := ""
+	calibrationFile := ""
+	metadataFile := ""
+	inventoryFile := ""
+	if pb.Config.StateFolder != "" {
+		countersFile = path.Join(pb.Config.StateFolder, pb.Config.ClientID+"-counters.json")
+		calibrationFile = path.Join(pb.Config.StateFolder, pb.Config.ClientID+"-calibration.json")
+		metadataFile = path.Join(pb.Config.StateFolder, pb.Config.ClientID+"-devices.json")
+		inventoryFile = path.Join(pb.Config.StateFolder, pb.Config.ClientID+"-nodes.json")
 	}
+	pb.counters = counters.NewCounterStore(countersFile)
+	pb.calibration = calibration.NewCalibrationStore(pb.Config.Calibration, calibrationFile)
+	pb.validator = validation.NewValidator(pb.Config.Validation.Families, pb.Config.Validation.Devices)
+	pb.filters = filters.NewFilterStore(pb.Config.Filters.Sensors, pb.Config.Filters.Devices)
+	pb.deadbands = deadband.NewDeadbandStore(pb.Config.Deadbands)
+	pb.metadata = metadata.NewMetadataStore(pb.Config.Devices, metadataFile)
+	pb.inventory = inventory.NewInventoryStore(inventoryFile)
+	pb.metrics = metrics.NewMetrics(time.Now())
 
 	// Create the adapter for the OWServer 1-wire gateway
 	pb.edsAPI = eds.NewEdsAPI(config.EdsAddress, config.LoginName, config.Password)
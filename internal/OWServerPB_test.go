@@ -1,6 +1,8 @@
 package internal_test
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -21,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
 )
 
 //var homeFolder string
@@ -76,6 +79,44 @@ func TestMain(m *testing.M) {
 	os.Exit(result)
 }
 
+// dryRunOutput collects the JSON lines written by the dry-run factory
+type dryRunOutput struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+// Write a JSON line
+func (out *dryRunOutput) Write(p []byte) (int, error) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	return out.buf.Write(p)
+}
+
+// Messages returns the messages of a type, or of all types if msgType is ""
+func (out *dryRunOutput) Messages(msgType string) []dryrun.Message {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	messages := make([]dryrun.Message, 0)
+	for _, line := range bytes.Split(out.buf.Bytes(), []byte("\n")) {
+		msg := dryrun.Message{}
+		if json.Unmarshal(line, &msg) == nil && (msgType == "" || msg.Type == msgType) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// startDryRun starts the service with the dry-run factory, so it runs without a message bus
+// The caller must stop the service.
+func startDryRun(t *testing.T, cfg internal.OWServerPBConfig) (*internal.OWServerPB, *dryRunOutput) {
+	out := &dryRunOutput{}
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	svc.SetThingFactory(dryrun.NewDryRunFactory(out, internal.PropNameStatus))
+	err := svc.Start()
+	require.NoError(t, err)
+	return svc, out
+}
+
 func TestStartStop(t *testing.T) {
 	logrus.Infof("--- TestStartStop ---")
 	var rxMsg []byte
@@ -212,8 +253,10 @@ func TestPollValuesNotInitialized(t *testing.T) {
 func TestPollInvalidEDSAddress(t *testing.T) {
 	logrus.Infof("--- TestPollInvalidEDSAddress ---")
 
-	owsConfig.EdsAddress = "http://invalidAddress/"
-	svc := internal.NewOWServerPB(owsConfig,
+	// use a copy so the following tests keep the simulation file
+	cfg := owsConfig
+	cfg.EdsAddress = "http://invalidAddress/"
+	svc := internal.NewOWServerPB(cfg,
 		testenv.ServerAddress, testenv.MqttPortCert, testCerts.CaCert, testCerts.PluginCert)
 	assert.NotNil(t, svc)
 
@@ -0,0 +1,208 @@
+// Package internal reloads the service configuration when the configuration file changes
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigPollInterval is the interval to check the configuration file for changes
+const ConfigPollInterval = 5 * time.Second
+
+// LiveSettings are the settings, by their name in the configuration file, that are applied
+// without a restart when the configuration file changes.
+var LiveSettings = []string{
+	"owserverAddress", "loginName", "password", "passwordFile",
+	"tdInterval", "valueInterval", "metricsInterval", "readyIntervals",
+	"staleNodeExpiry", "logLevel", "deadbands", "filters", "devices",
+}
+
+// isLiveSetting returns true if the setting is applied without a restart
+func isLiveSetting(name string) bool {
+	for _, liveSetting := range LiveSettings {
+		if liveSetting == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangedSettings returns the names of the settings that differ between two configurations
+// Empty and missing lists and maps are considered equal.
+func ChangedSettings(oldConfig OWServerPBConfig, newConfig OWServerPBConfig) []string {
+	changed := make([]string, 0)
+	oldValue := reflect.ValueOf(oldConfig)
+	newValue := reflect.ValueOf(newConfig)
+	for i := 0; i < oldValue.NumField(); i++ {
+		oldField := oldValue.Field(i)
+		newField := newValue.Field(i)
+		switch oldField.Kind() {
+		case reflect.Map, reflect.Slice:
+			if oldField.Len() == 0 && newField.Len() == 0 {
+				continue
+			}
+		}
+		if !reflect.DeepEqual(oldField.Interface(), newField.Interface()) {
+			name := strings.Split(oldValue.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// ApplyConfig applies the settings of a new configuration that can be applied without restart
+// Changes of other settings are logged as requiring a restart and are otherwise ignored.
+// The new configuration is rejected if one of its settings is invalid.
+//  newConfig is the new configuration. Zone and StateFolder keep their value if not set.
+// This returns the names of the applied settings.
+func (pb *OWServerPB) ApplyConfig(newConfig OWServerPBConfig) (applied []string, err error) {
+	pb.mu.Lock()
+	oldConfig := pb.Config
+	pb.mu.Unlock()
+	// zone and state folder default to hub settings
+	if newConfig.Zone == "" {
+		newConfig.Zone = oldConfig.Zone
+	}
+	if newConfig.StateFolder == "" {
+		newConfig.StateFolder = oldConfig.StateFolder
+	}
+	err = ValidateConfig(newConfig).Err()
+	if err != nil {
+		logrus.Errorf("Rejected the new configuration:\n%s", err)
+		return nil, err
+	}
+	SetConfigDefaults(&newConfig)
+
+	// keep the current value of settings that require a restart
+	applied = make([]string, 0)
+	newValue := reflect.ValueOf(&newConfig).Elem()
+	oldValue := reflect.ValueOf(oldConfig)
+	restartSettings := make([]string, 0)
+	for _, name := range ChangedSettings(oldConfig, newConfig) {
+		if isLiveSetting(name) {
+			applied = append(applied, name)
+			continue
+		}
+		restartSettings = append(restartSettings, name)
+		for i := 0; i < newValue.NumField(); i++ {
+			if strings.Split(newValue.Type().Field(i).Tag.Get("yaml"), ",")[0] == name {
+				newValue.Field(i).Set(oldValue.Field(i))
+			}
+		}
+	}
+	if len(restartSettings) > 0 {
+		sort.Strings(restartSettings)
+		logrus.Warningf("Changed settings %v require a restart of the service", restartSettings)
+	}
+	if len(applied) == 0 {
+		return applied, nil
+	}
+
+	pb.mu.Lock()
+	pb.Config = newConfig
+	pb.mu.Unlock()
+	// keep a discovered gateway address unless the configured address changed
+	if newConfig.EdsAddress != oldConfig.EdsAddress {
+		pb.edsAPI.SetAddress(newConfig.EdsAddress)
+	}
+	pb.edsAPI.SetLogin(newConfig.LoginName, newConfig.Password)
+	if newConfig.LogLevel != "" {
+		_ = SetLogLevel(newConfig.LogLevel)
+	} else {
+		logrus.SetLevel(pb.defaultLogLevel)
+	}
+	if !reflect.DeepEqual(oldConfig.Deadbands, newConfig.Deadbands) {
+		_ = pb.deadbands.SetDeadbands(newConfig.Deadbands)
+	}
+	pb.filters.SetConfig(newConfig.Filters.Sensors, newConfig.Filters.Devices)
+	pb.metadata.SetConfigured(newConfig.Devices)
+	sort.Strings(applied)
+	logrus.Warningf("Applied changed settings %v", applied)
+
+	pb.mu.Lock()
+	serviceEThing := pb.serviceEThing
+	pb.mu.Unlock()
+	if serviceEThing != nil {
+		_ = serviceEThing.EmitPropertiesChange(pb.GetServiceConfigValues(), true)
+	}
+	return applied, nil
+}
+
+// ReloadConfig reloads the configuration file and applies the changed settings
+// This has no effect if no configuration file is set.
+func (pb *OWServerPB) ReloadConfig() error {
+	if pb.configFile == "" {
+		return nil
+	}
+	newConfig, err := LoadConfigFile(pb.configFile, pb.configSubstitutes)
+	if err != nil {
+		logrus.Errorf("Unable to reload the configuration from '%s':\n%s", pb.configFile, err)
+		return err
+	}
+	applied, err := pb.ApplyConfig(newConfig)
+	if err != nil {
+		return err
+	}
+	// a new gateway, credentials, filters or device metadata affect the TDs and values
+	for _, name := range applied {
+		if name == "owserverAddress" || name == "loginName" || name == "password" ||
+			name == "passwordFile" || name == "filters" || name == "devices" {
+			_ = pb.UpdateExposedThings()
+			_ = pb.UpdatePropertyValues(false)
+			break
+		}
+	}
+	return nil
+}
+
+// watchConfigFile reloads the configuration when the configuration file is modified or the
+// service receives a SIGHUP signal, until the service stops.
+func (pb *OWServerPB) watchConfigFile() {
+	hupChannel := make(chan os.Signal, 1)
+	signal.Notify(hupChannel, syscall.SIGHUP)
+	defer signal.Stop(hupChannel)
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+
+	fileState := func() string {
+		info, err := os.Stat(pb.configFile)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s-%d", info.ModTime(), info.Size())
+	}
+	lastState := fileState()
+	for {
+		reload := false
+		select {
+		case <-hupChannel:
+			logrus.Infof("Received SIGHUP, reloading the configuration")
+			reload = true
+		case <-ticker.C:
+			state := fileState()
+			if state != lastState && state != "" {
+				logrus.Infof("Configuration file '%s' changed, reloading it", pb.configFile)
+				reload = true
+			}
+			lastState = state
+		}
+		pb.mu.Lock()
+		isRunning := pb.running
+		pb.mu.Unlock()
+		if !isRunning {
+			return
+		}
+		if reload {
+			lastState = fileState()
+			_ = pb.ReloadConfig()
+		}
+	}
+}
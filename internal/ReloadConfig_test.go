@@ -0,0 +1,122 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+)
+
+func TestChangedSettings(t *testing.T) {
+	oldConfig := owsConfig
+	newConfig := owsConfig
+	assert.Empty(t, internal.ChangedSettings(oldConfig, newConfig))
+
+	// empty and missing maps are equal
+	oldConfig.Deadbands = nil
+	newConfig.Deadbands = map[string]float64{}
+	assert.Empty(t, internal.ChangedSettings(oldConfig, newConfig))
+
+	newConfig.Deadbands = map[string]float64{"temperature": 0.2}
+	newConfig.ValueInterval = oldConfig.ValueInterval + 1
+	newConfig.HistorySize = oldConfig.HistorySize + 1
+	changed := internal.ChangedSettings(oldConfig, newConfig)
+	assert.ElementsMatch(t, []string{"deadbands", "valueInterval", "historySize"}, changed)
+}
+
+func TestApplyLiveSetting(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	newConfig := svc.Config
+	newConfig.ValueInterval = svc.Config.ValueInterval + 10
+	newConfig.Deadbands = map[string]float64{"temperature": 0.2}
+
+	applied, err := svc.ApplyConfig(newConfig)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"deadbands", "valueInterval"}, applied)
+	assert.Equal(t, newConfig.ValueInterval, svc.Config.ValueInterval)
+	assert.Equal(t, "temperature=0.2", svc.GetServiceConfigValues()[internal.PropNameDeadbands])
+}
+
+func TestApplyRestartSetting(t *testing.T) {
+	logHook := logtest.NewLocal(logrus.StandardLogger())
+	defer logHook.Reset()
+	logLevel := logrus.GetLevel()
+	defer logrus.SetLevel(logLevel)
+	logrus.SetLevel(logrus.WarnLevel)
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	oldHistorySize := svc.Config.HistorySize
+	newConfig := svc.Config
+	newConfig.HistorySize = oldHistorySize + 100
+	newConfig.ValueInterval = svc.Config.ValueInterval + 10
+
+	applied, err := svc.ApplyConfig(newConfig)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"valueInterval"}, applied)
+	assert.Equal(t, oldHistorySize, svc.Config.HistorySize, "restart-only settings keep their value")
+	assert.Equal(t, newConfig.ValueInterval, svc.Config.ValueInterval)
+
+	logged := false
+	for _, entry := range logHook.AllEntries() {
+		if entry.Level == logrus.WarnLevel && strings.Contains(entry.Message, "historySize") &&
+			strings.Contains(entry.Message, "require a restart") {
+			logged = true
+		}
+	}
+	assert.True(t, logged, "the restart-only setting is logged")
+}
+
+func TestApplyInvalidConfig(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	oldConfig := svc.Config
+	newConfig := svc.Config
+	newConfig.TDInterval = oldConfig.TDInterval + 10
+	newConfig.ValueInterval = -1
+
+	applied, err := svc.ApplyConfig(newConfig)
+	assert.Error(t, err)
+	assert.Empty(t, applied)
+	assert.Equal(t, oldConfig, svc.Config, "the old configuration stays")
+}
+
+func TestServiceWriteWithEnvOverride(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	err := svc.SetServiceConfig(internal.PropNameValueInterval, "45")
+	require.NoError(t, err)
+	assert.Equal(t, 45, svc.Config.ValueInterval)
+
+	// the environment variable would revert the write when the saved file is reloaded
+	t.Setenv(internal.EnvPrefix+"VALUE_INTERVAL", "30")
+	err = svc.SetServiceConfig(internal.PropNameValueInterval, "60")
+	assert.Error(t, err)
+	assert.Equal(t, 45, svc.Config.ValueInterval)
+
+	// other settings can still be changed
+	err = svc.SetServiceConfig(internal.PropNameTDInterval, "600")
+	assert.NoError(t, err)
+}
+
+func TestApplyKeepsDiscoveredAddress(t *testing.T) {
+	cfg := owsConfig
+	cfg.EdsAddress = ""
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	svc.SetGatewayAddress("192.168.0.10")
+	newConfig := svc.Config
+	newConfig.ValueInterval = svc.Config.ValueInterval + 10
+
+	_, err := svc.ApplyConfig(newConfig)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.0.10", svc.GetServiceConfigValues()[vocab.PropNameGatewayAddress])
+
+	// a changed address is used
+	newConfig.EdsAddress = owsSimulationFile
+	applied, err := svc.ApplyConfig(newConfig)
+	require.NoError(t, err)
+	assert.Contains(t, applied, "owserverAddress")
+	assert.Equal(t, owsSimulationFile, svc.GetServiceConfigValues()[vocab.PropNameGatewayAddress])
+}
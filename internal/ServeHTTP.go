@@ -0,0 +1,59 @@
+// Package internal serves the HTTP endpoints of the service
+package internal
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartHTTPServers starts the HTTP listeners of the metrics and health endpoints that have an
+// address configured. Endpoints configured with the same address share a listener.
+func (pb *OWServerPB) StartHTTPServers() error {
+	muxes := make(map[string]*http.ServeMux)
+	addresses := make([]string, 0, 2)
+	addHandler := func(address string, path string, handler http.HandlerFunc) {
+		if address == "" {
+			return
+		}
+		mux, found := muxes[address]
+		if !found {
+			mux = http.NewServeMux()
+			muxes[address] = mux
+			addresses = append(addresses, address)
+		}
+		mux.HandleFunc(path, handler)
+	}
+	addHandler(pb.Config.PrometheusAddress, MetricsPath, pb.HandleMetricsRequest)
+	addHandler(pb.Config.HealthAddress, HealthzPath, pb.HandleHealthzRequest)
+	addHandler(pb.Config.HealthAddress, ReadyzPath, pb.HandleReadyzRequest)
+
+	for _, address := range addresses {
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			logrus.Errorf("Unable to listen for HTTP requests on '%s': %s", address, err)
+			pb.StopHTTPServers()
+			return err
+		}
+		server := &http.Server{Handler: muxes[address], ReadHeaderTimeout: 10 * time.Second}
+		pb.httpServers = append(pb.httpServers, server)
+		logrus.Infof("Serving HTTP endpoints on http://%s", listener.Addr())
+		go func() {
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				logrus.Errorf("HTTP server stopped: %s", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// StopHTTPServers stops the HTTP listeners of the metrics and health endpoints, if running
+func (pb *OWServerPB) StopHTTPServers() {
+	for _, server := range pb.httpServers {
+		_ = server.Close()
+	}
+	pb.httpServers = nil
+}
@@ -0,0 +1,115 @@
+// Package internal serves the liveness and readiness of the service
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/sdnotify"
+)
+
+// Paths of the health endpoints
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+)
+
+// HeartbeatTimeout is the maximum time between heartbeats before the service is considered hung
+const HeartbeatTimeout = 60 * time.Second
+
+// CheckLiveness returns an error if the heartbeat hasn't made progress within the HeartbeatTimeout
+//  now is the time to check against
+func (pb *OWServerPB) CheckLiveness(now time.Time) error {
+	pb.mu.Lock()
+	lastHeartbeat := pb.lastHeartbeat
+	isRunning := pb.running
+	pb.mu.Unlock()
+	if !isRunning {
+		return fmt.Errorf("service is not running")
+	}
+	if stalled := now.Sub(lastHeartbeat); stalled > HeartbeatTimeout {
+		return fmt.Errorf("heartbeat stalled for %s", stalled.Round(time.Second))
+	}
+	return nil
+}
+
+// IsBusConnected returns true if the service is connected to the message bus and the last
+// publication succeeded. Factories that report their connection state, see ConnectionStatus,
+// are asked for it. Otherwise the connection made on start is assumed to be kept.
+func (pb *OWServerPB) IsBusConnected() bool {
+	pb.mu.Lock()
+	busConnected := pb.busConnected
+	pb.mu.Unlock()
+	if !busConnected || !pb.metrics.GetSnapshot(time.Now()).BusUp {
+		return false
+	}
+	if status, ok := pb.eFactory.(ConnectionStatus); ok {
+		return status.IsConnected()
+	}
+	return true
+}
+
+// CheckReadiness returns an error if the service is not live, the message bus is down or the
+// last successful poll of the gateway is older than the configured number of value intervals.
+//  now is the time to check against
+func (pb *OWServerPB) CheckReadiness(now time.Time) error {
+	err := pb.CheckLiveness(now)
+	if err != nil {
+		return err
+	}
+	pb.mu.Lock()
+	maxPollAge := time.Duration(pb.Config.ReadyIntervals*pb.Config.ValueInterval) * time.Second
+	pb.mu.Unlock()
+	if !pb.IsBusConnected() {
+		return fmt.Errorf("message bus is down")
+	}
+	snapshot := pb.metrics.GetSnapshot(now)
+	if snapshot.LastPollTime.IsZero() {
+		return fmt.Errorf("gateway has not been polled successfully")
+	}
+	if pollAge := now.Sub(snapshot.LastPollTime); pollAge > maxPollAge {
+		return fmt.Errorf("last successful gateway poll was %s ago", pollAge.Round(time.Second))
+	}
+	return nil
+}
+
+// HandleHealthzRequest serves the liveness endpoint
+// This responds with 200 OK if the heartbeat makes progress and 503 otherwise.
+func (pb *OWServerPB) HandleHealthzRequest(w http.ResponseWriter, r *http.Request) {
+	writeHealthResponse(w, r, pb.CheckLiveness(time.Now()))
+}
+
+// HandleReadyzRequest serves the readiness endpoint
+// This responds with 200 OK if the service is live, connected to the message bus and recently
+// polled the gateway, and 503 otherwise.
+func (pb *OWServerPB) HandleReadyzRequest(w http.ResponseWriter, r *http.Request) {
+	writeHealthResponse(w, r, pb.CheckReadiness(time.Now()))
+}
+
+// writeHealthResponse writes the result of a health check as plain text
+func writeHealthResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
+
+// NotifySystemd sends a state notification to systemd, if the service is run by systemd
+// with notification support.
+//  state is the notification, eg sdnotify.StateReady
+func NotifySystemd(state string) {
+	_, err := sdnotify.Notify(state)
+	if err != nil {
+		logrus.Warningf("Unable to notify systemd of '%s': %s", state, err)
+	}
+}
@@ -0,0 +1,101 @@
+package internal_test
+
+import (
+	"net"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+	"github.com/wostzone/owserver/internal/sdnotify"
+)
+
+// disconnectedFactory is a dry-run factory that reports a lost message bus connection
+type disconnectedFactory struct {
+	*dryrun.DryRunFactory
+}
+
+// IsConnected returns false as the connection is lost
+func (factory *disconnectedFactory) IsConnected() bool {
+	return false
+}
+
+// listenSystemd listens for systemd notifications
+func listenSystemd(t *testing.T) *net.UnixConn {
+	socketName := path.Join(os.TempDir(), "owserver-ready-test.sock")
+	_ = os.Remove(socketName)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketName, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = os.Remove(socketName)
+	})
+	t.Setenv("NOTIFY_SOCKET", socketName)
+	return conn
+}
+
+// waitForReady returns true if the ready notification is received before the timeout
+func waitForReady(conn *net.UnixConn, timeout time.Duration) bool {
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return false
+		}
+		if strings.Contains(string(buf[:n]), sdnotify.StateReady) {
+			return true
+		}
+	}
+}
+
+func TestNotifyReadyAfterPoll(t *testing.T) {
+	conn := listenSystemd(t)
+	svc, _ := startDryRun(t, owsConfig)
+	defer svc.Stop()
+
+	assert.True(t, waitForReady(conn, 5*time.Second))
+	assert.NoError(t, svc.CheckReadiness(time.Now()))
+}
+
+func TestNoReadyWithoutGateway(t *testing.T) {
+	conn := listenSystemd(t)
+	cfg := owsConfig
+	cfg.EdsAddress = "file://" + path.Join(t.TempDir(), "missing.xml")
+	svc, _ := startDryRun(t, cfg)
+	defer svc.Stop()
+
+	assert.False(t, waitForReady(conn, 2*time.Second), "ready is sent before the gateway is polled")
+	assert.Error(t, svc.CheckReadiness(time.Now()))
+}
+
+func TestBusConnected(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	svc.SetThingFactory(dryrun.NewDryRunFactory(&dryRunOutput{}, internal.PropNameStatus))
+	assert.False(t, svc.IsBusConnected(), "not connected before start")
+	require.NoError(t, svc.Start())
+	assert.True(t, svc.IsBusConnected())
+	svc.Stop()
+	assert.False(t, svc.IsBusConnected(), "not connected after stop")
+
+	// the factory connection state is used
+	svc = internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	factory := &disconnectedFactory{dryrun.NewDryRunFactory(&dryRunOutput{}, internal.PropNameStatus)}
+	svc.SetThingFactory(factory)
+	require.NoError(t, svc.Start())
+	defer svc.Stop()
+	assert.False(t, svc.IsBusConnected())
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+	err = svc.UpdatePropertyValues(false)
+	require.NoError(t, err)
+	err = svc.CheckReadiness(time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "message bus is down")
+}
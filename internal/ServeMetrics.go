@@ -0,0 +1,138 @@
+// Package internal serves the metrics of the service to Prometheus
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wostzone/owserver/internal/metrics"
+	"github.com/wostzone/owserver/internal/openmetrics"
+)
+
+// MetricsPath is the HTTP path of the metrics endpoint
+const MetricsPath = "/metrics"
+
+// WriteMetrics writes the metrics of the service in the Prometheus text exposition format
+// If enabled, this includes the last known sensor values of the devices.
+func (pb *OWServerPB) WriteMetrics(e *openmetrics.Exposition) {
+	pb.mu.Lock()
+	pb.metrics.SetThingsExposed(len(pb.eThings) + len(pb.aliasThings))
+	pb.mu.Unlock()
+	snapshot := pb.metrics.GetSnapshot(time.Now())
+
+	gatewayUp := 0.0
+	if snapshot.GatewayUp {
+		gatewayUp = 1
+	}
+	e.AddFamily("owserver_gateway_up", "1 if the last poll of the gateway succeeded", openmetrics.TypeGauge)
+	e.AddSample("owserver_gateway_up", nil, gatewayUp)
+
+	busUp := 0.0
+	if pb.IsBusConnected() {
+		busUp = 1
+	}
+	e.AddFamily("owserver_bus_up", "1 if connected to the message bus and the last publication succeeded",
+		openmetrics.TypeGauge)
+	e.AddSample("owserver_bus_up", nil, busUp)
+
+	e.AddFamily("owserver_polls_total", "Number of polls of the gateway by result", openmetrics.TypeCounter)
+	e.AddSample("owserver_polls_total", []openmetrics.Label{{"result", "success"}},
+		float64(snapshot.PollSuccessCount))
+	e.AddSample("owserver_polls_total", []openmetrics.Label{{"result", "failure"}},
+		float64(snapshot.PollFailureCount))
+
+	e.AddFamily("owserver_poll_errors_total", "Number of failed polls of the gateway by error type",
+		openmetrics.TypeCounter)
+	for _, errorType := range []string{metrics.ErrorTypeTimeout, metrics.ErrorTypeConnection,
+		metrics.ErrorTypeParse, metrics.ErrorTypeOther} {
+		e.AddSample("owserver_poll_errors_total", []openmetrics.Label{{"type", errorType}},
+			float64(snapshot.PollErrors[errorType]))
+	}
+
+	e.AddHistogram("owserver_poll_latency_seconds", "Latency of successful polls of the gateway",
+		metrics.LatencyBuckets, snapshot.LatencyBucketCounts, snapshot.LatencySum, snapshot.PollSuccessCount)
+
+	if !snapshot.LastPollTime.IsZero() {
+		e.AddFamily("owserver_last_poll_timestamp_seconds", "Time of the last successful poll of the gateway",
+			openmetrics.TypeGauge)
+		e.AddSample("owserver_last_poll_timestamp_seconds", nil,
+			float64(snapshot.LastPollTime.UnixMilli())/1000)
+	}
+
+	e.AddFamily("owserver_things_exposed", "Number of Things published by the service", openmetrics.TypeGauge)
+	e.AddSample("owserver_things_exposed", nil, float64(snapshot.ThingsExposed))
+
+	e.AddFamily("owserver_messages_published_total", "Number of messages published on the message bus",
+		openmetrics.TypeCounter)
+	e.AddSample("owserver_messages_published_total", nil, float64(snapshot.MessagesTotal))
+
+	e.AddFamily("owserver_writes_total", "Number of writes to devices by result", openmetrics.TypeCounter)
+	e.AddSample("owserver_writes_total", []openmetrics.Label{{"result", "success"}},
+		float64(snapshot.WriteSuccessCount))
+	e.AddSample("owserver_writes_total", []openmetrics.Label{{"result", "failure"}},
+		float64(snapshot.WriteFailureCount))
+
+	e.AddFamily("owserver_uptime_seconds", "Time since the service started", openmetrics.TypeGauge)
+	e.AddSample("owserver_uptime_seconds", nil, snapshot.Uptime.Seconds())
+
+	if pb.Config.PrometheusSensors {
+		pb.writeSensorMetrics(e)
+	}
+}
+
+// writeSensorMetrics writes the last known sensor values and the last seen time of the devices
+// Sensor values are labeled by ROM ID, family, channel, friendly name, sensor and unit.
+func (pb *OWServerPB) writeSensorMetrics(e *openmetrics.Exposition) {
+	romIDs := pb.inventory.GetIDs()
+	sort.Strings(romIDs)
+
+	e.AddFamily("owserver_device_last_seen_timestamp_seconds", "Time the device last reported its values",
+		openmetrics.TypeGauge)
+	for _, romID := range romIDs {
+		record := pb.inventory.Get(romID)
+		e.AddSample("owserver_device_last_seen_timestamp_seconds",
+			[]openmetrics.Label{{"rom_id", romID}}, float64(record.LastSeen.UnixMilli())/1000)
+	}
+
+	e.AddFamily("owserver_sensor_value", "Last known value of a 1-wire sensor", openmetrics.TypeGauge)
+	for _, romID := range romIDs {
+		record := pb.inventory.Get(romID)
+		node := record.Node
+		friendlyName := pb.GetNodeMetadata(node).Title
+		sensorNames := make([]string, 0, len(node.Attr))
+		for name, attr := range node.Attr {
+			if attr.IsSensor {
+				sensorNames = append(sensorNames, name)
+			}
+		}
+		sort.Strings(sensorNames)
+		for _, name := range sensorNames {
+			value, err := strconv.ParseFloat(record.Values[name], 64)
+			if err != nil {
+				continue
+			}
+			e.AddSample("owserver_sensor_value", []openmetrics.Label{
+				{"rom_id", romID},
+				{"family", node.Attr["Family"].Value},
+				{"channel", node.Attr["Channel"].Value},
+				{"name", friendlyName},
+				{"sensor", name},
+				{"unit", node.Attr[name].Unit},
+			}, value)
+		}
+	}
+}
+
+// HandleMetricsRequest serves the metrics endpoint
+func (pb *OWServerPB) HandleMetricsRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	e := openmetrics.Exposition{}
+	pb.WriteMetrics(&e)
+	w.Header().Set("Content-Type", openmetrics.ContentType)
+	_, _ = w.Write(e.Bytes())
+}
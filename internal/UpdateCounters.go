@@ -0,0 +1,77 @@
+// Package internal with pulse counter totals and rates
+package internal
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// CounterConfig with the scaling of a pulse counter
+type CounterConfig struct {
+	// PulsesPerUnit is the number of pulses per unit, eg 1000 pulses per kWh. Default is 1.
+	PulsesPerUnit float64 `yaml:"pulsesPerUnit,omitempty"`
+	// Unit of the counter total, eg "kWh" or "L". Default is "#"
+	Unit string `yaml:"unit,omitempty"`
+}
+
+// counterRates are the rates published for each counter with their duration in seconds
+var counterRates = []struct {
+	name    string
+	title   string
+	seconds float64
+	unit    string
+}{
+	{name: "RatePerSecond", title: " rate per second", seconds: 1, unit: "/s"},
+	{name: "RatePerMinute", title: " rate per minute", seconds: 60, unit: "/min"},
+	{name: "RatePerHour", title: " rate per hour", seconds: 3600, unit: "/h"},
+}
+
+// GetCounterConfig returns the scaling configuration of a counter
+func (pb *OWServerPB) GetCounterConfig(nodeID string, counterName string) CounterConfig {
+	counterConfig := pb.Config.Counters[nodeID][counterName]
+	if counterConfig.PulsesPerUnit <= 0 {
+		counterConfig.PulsesPerUnit = 1
+	}
+	if counterConfig.Unit == "" {
+		counterConfig.Unit = vocab.UnitNameCount
+	}
+	return counterConfig
+}
+
+// AddCounterAffordances adds read-only properties for the total and rates of a pulse counter
+func (pb *OWServerPB) AddCounterAffordances(tdoc *thing.ThingTD, nodeID string, attrName string) {
+	counterConfig := pb.GetCounterConfig(nodeID, attrName)
+	prop := tdoc.AddProperty(attrName+"Total", attrName+" total", vocab.WoTDataTypeNumber)
+	prop.Unit = counterConfig.Unit
+	prop.ReadOnly = true
+	for _, rate := range counterRates {
+		prop = tdoc.AddProperty(attrName+rate.name, attrName+rate.title, vocab.WoTDataTypeNumber)
+		prop.Unit = counterConfig.Unit + rate.unit
+		prop.ReadOnly = true
+	}
+}
+
+// UpdateCounter updates the total of a pulse counter with a new raw counter value and adds the
+// scaled total and rates to the property values of the node.
+// The totals are saved every TD interval and when the service stops, to limit writes to the
+// SD card of a Raspberry Pi.
+func (pb *OWServerPB) UpdateCounter(nodeID string, counterName string, attr eds.OneWireAttr,
+	timestamp time.Time, propValues map[string]interface{}) {
+
+	count, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return
+	}
+	counterConfig := pb.GetCounterConfig(nodeID, counterName)
+	total, rate, hasRate := pb.counters.Update(nodeID, counterName, count, timestamp)
+	propValues[counterName+"Total"] = eds.FormatValue(total/counterConfig.PulsesPerUnit, 3)
+	if hasRate {
+		for _, r := range counterRates {
+			propValues[counterName+r.name] = eds.FormatValue(rate*r.seconds/counterConfig.PulsesPerUnit, 3)
+		}
+	}
+}
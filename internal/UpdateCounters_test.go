@@ -0,0 +1,95 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/counters"
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+// counterRomID is the ROM ID of the EDS0068 with counters in the simulation file
+const counterRomID = "C100100000267C7E"
+
+// writeCounterSimFile writes the simulation file with the raw value of counter1 increased
+func writeCounterSimFile(t *testing.T, simFile string, increase int) {
+	simData, err := ioutil.ReadFile(strings.TrimPrefix(owsSimulationFile, "file://"))
+	require.NoError(t, err)
+	text := strings.Replace(string(simData), "<Counter1>8214566</Counter1>",
+		"<Counter1>"+strconv.Itoa(8214566+increase)+"</Counter1>", 1)
+	err = ioutil.WriteFile(simFile, []byte(text), 0600)
+	require.NoError(t, err)
+}
+
+// lastCounterTotal returns the last published total of counter1, or nil if none was published
+func lastCounterTotal(out *dryRunOutput) interface{} {
+	var total interface{}
+	for _, msg := range out.Messages(dryrun.MessageTypeProperties) {
+		values, _ := msg.Data.(map[string]interface{})
+		if value, found := values["counter1Total"]; found && msg.DeviceID == counterRomID {
+			total = value
+		}
+	}
+	return total
+}
+
+func TestCounterAffordances(t *testing.T) {
+	pb := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	tdoc := thing.CreateTD("urn:local:owserver:counter1", "Counter", vocab.DeviceTypeSensor)
+	pb.AddCounterAffordances(tdoc, "counter1", "counter1")
+
+	titles := make(map[string]bool)
+	for _, propName := range []string{"counter1Total", "counter1RatePerSecond",
+		"counter1RatePerMinute", "counter1RatePerHour"} {
+		prop := tdoc.GetProperty(propName)
+		require.NotNil(t, prop, propName)
+		titles[prop.Title] = true
+	}
+	assert.Len(t, titles, 4, "each counter property has its own title")
+}
+
+func TestCounterTotalsAfterRestart(t *testing.T) {
+	stateFolder := t.TempDir()
+	simFile := path.Join(stateFolder, "owserver-details.xml")
+	cfg := owsConfig
+	cfg.EdsAddress = "file://" + simFile
+	cfg.StateFolder = stateFolder
+	cfg.TDInterval = 1
+	cfg.ValueInterval = 1
+	writeCounterSimFile(t, simFile, 0)
+	svc, _ := startDryRun(t, cfg)
+
+	// the totals are saved on the TD interval, without stopping the service
+	savedStore := counters.NewCounterStore(path.Join(stateFolder, cfg.ClientID+"-counters.json"))
+	savedTotal := func() float64 {
+		_ = savedStore.Load()
+		state := savedStore.Get(counterRomID, "counter1")
+		if state == nil {
+			return -1
+		}
+		return state.Total
+	}
+	require.Eventually(t, func() bool { return savedTotal() == 0 }, 5*time.Second, 100*time.Millisecond)
+	writeCounterSimFile(t, simFile, 100)
+	require.Eventually(t, func() bool { return savedTotal() == 100 }, 5*time.Second, 100*time.Millisecond)
+	svc.Stop()
+
+	// the new service continues from the saved totals
+	writeCounterSimFile(t, simFile, 150)
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+	// without the saved totals the new service would start again from 0
+	assert.Eventually(t, func() bool {
+		return lastCounterTotal(out) == "150.000"
+	}, 5*time.Second, 100*time.Millisecond)
+}
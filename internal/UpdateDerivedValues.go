@@ -0,0 +1,151 @@
+// Package internal with values derived from sensor values
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wostzone/owserver/internal/derived"
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Names of derived properties that are not in the vocabulary
+const (
+	PropNameAbsoluteHumidity = "absoluteHumidity"
+	PropNameSeaLevelPressure = "seaLevelPressure"
+)
+
+// PropNameDerivedProperties is the name of the property that lists the names of the derived
+// properties of a Thing, so consumers can tell them from measured values
+const PropNameDerivedProperties = "derivedProperties"
+
+// UnitNameGramsPerCubicMeter is the unit of absolute humidity
+const UnitNameGramsPerCubicMeter = "g/m3"
+
+// derivedValue holds a value computed by the binding from sensor values
+type derivedValue struct {
+	title string
+	// atType is the semantic type of the measured property of the same quantity
+	atType   string
+	unit     string
+	value    float64
+	decimals int
+}
+
+// computeDerivedValues computes the derived values that apply to a node. Values that are
+// reported by the device itself are not computed.
+// This returns a map of derived property name to derived value.
+//  node whose attributes determine the units and which values the device reports
+//  values with the current property values of the node
+func (pb *OWServerPB) computeDerivedValues(
+	node *eds.OneWireNode, values map[string]interface{}) map[string]derivedValue {
+
+	result := make(map[string]derivedValue)
+	if !pb.Config.DerivedValues {
+		return result
+	}
+	getFloat := func(name string) (float64, bool) {
+		valueStr, _ := values[name].(string)
+		valueFloat, err := strconv.ParseFloat(valueStr, 64)
+		return valueFloat, err == nil
+	}
+	tempAttr, hasTempAttr := node.Attr[vocab.PropNameTemperature]
+	temperature, hasTemp := getFloat(vocab.PropNameTemperature)
+	humidity, hasHumidity := getFloat(vocab.PropNameHumidity)
+	hasTemp = hasTemp && hasTempAttr
+	isFahrenheit := hasTempAttr && tempAttr.Unit == vocab.UnitNameFahrenheit
+	if isFahrenheit {
+		temperature = derived.FahrenheitToCelsius(temperature)
+	}
+	// temperatures are reported in the unit of the temperature sensor
+	toTempUnit := func(celsius float64) float64 {
+		if isFahrenheit {
+			return derived.CelsiusToFahrenheit(celsius)
+		}
+		return celsius
+	}
+	// edsName is the OWServer attribute of the same quantity, for its semantic type
+	addValue := func(name string, title string, edsName string, unit string, value float64, decimals int) {
+		if _, isReported := node.Attr[name]; !isReported {
+			result[name] = derivedValue{title: title, atType: eds.AttrInfoVocab[edsName].AtType,
+				unit: unit, value: value, decimals: decimals}
+		}
+	}
+
+	if hasTemp && hasHumidity {
+		dewPoint := derived.DewPoint(temperature, humidity)
+		addValue(vocab.PropNameDewpoint, "Dew point", "DewPoint", tempAttr.Unit, toTempUnit(dewPoint), 1)
+		addValue(vocab.PropNameHumidex, "Humidex", "Humidex", tempAttr.Unit,
+			toTempUnit(derived.Humidex(temperature, dewPoint)), 1)
+		addValue(vocab.PropNameHeatIndex, "Heat index", "HeatIndex", tempAttr.Unit,
+			toTempUnit(derived.HeatIndex(temperature, humidity)), 1)
+		addValue(PropNameAbsoluteHumidity, "Absolute humidity", "Humidity", UnitNameGramsPerCubicMeter,
+			derived.AbsoluteHumidity(temperature, humidity), 1)
+	}
+	pressureAttr, hasPressureAttr := node.Attr[vocab.PropNameAtmosphericPressure]
+	pressure, hasPressure := getFloat(vocab.PropNameAtmosphericPressure)
+	if hasPressure && hasPressureAttr && pb.Config.Altitude != 0 &&
+		pressureAttr.Unit == vocab.UnitNameMillibar {
+		if !hasTemp {
+			// use the standard atmosphere temperature
+			temperature = 15
+		}
+		addValue(PropNameSeaLevelPressure, "Sea level pressure", "BarometricPressureMb", vocab.UnitNameMillibar,
+			derived.SeaLevelPressure(pressure, pb.Config.Altitude, temperature), 1)
+	}
+	return result
+}
+
+// derivedPropertyNames returns the sorted names of the derived values, joined with commas
+func derivedPropertyNames(derivedValues map[string]derivedValue) string {
+	names := make([]string, 0, len(derivedValues))
+	for propName := range derivedValues {
+		names = append(names, propName)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// AddDerivedAffordances adds read-only properties for the values that are derived from
+// the sensor values of the node.
+// Derived properties have the semantic type of the measured quantity, eg a dew point is a
+// temperature. The derivedProperties property lists their names as its constant value.
+func (pb *OWServerPB) AddDerivedAffordances(tdoc *thing.ThingTD, node *eds.OneWireNode) {
+	values := make(map[string]interface{})
+	for attrName, attr := range node.Attr {
+		values[attrName] = attr.Value
+	}
+	derivedValues := pb.computeDerivedValues(node, values)
+	if len(derivedValues) == 0 {
+		return
+	}
+	for propName, derivedVal := range derivedValues {
+		prop := tdoc.AddProperty(propName, derivedVal.title, vocab.WoTDataTypeNumber)
+		prop.Description = fmt.Sprintf("%s (derived). Computed by the binding from the sensor values.",
+			derivedVal.title)
+		prop.AtType = derivedVal.atType
+		prop.Unit = derivedVal.unit
+		prop.ReadOnly = true
+	}
+	prop := tdoc.AddProperty(PropNameDerivedProperties, "Derived properties", vocab.WoTDataTypeString)
+	prop.Description = "Names of the properties, separated by commas, that are computed by the " +
+		"binding instead of measured by the device"
+	prop.Const = derivedPropertyNames(derivedValues)
+	prop.ReadOnly = true
+}
+
+// UpdateDerivedValues computes the derived values of a node and adds them to its property values
+func (pb *OWServerPB) UpdateDerivedValues(node *eds.OneWireNode, propValues map[string]interface{}) {
+	derivedValues := pb.computeDerivedValues(node, propValues)
+	if len(derivedValues) == 0 {
+		return
+	}
+	for propName, derivedVal := range derivedValues {
+		propValues[propName] = eds.FormatValue(derivedVal.value, derivedVal.decimals)
+	}
+	propValues[PropNameDerivedProperties] = derivedPropertyNames(derivedValues)
+}
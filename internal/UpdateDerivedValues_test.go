@@ -0,0 +1,71 @@
+package internal_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+	"github.com/wostzone/owserver/internal/eds"
+)
+
+func TestDerivedAffordances(t *testing.T) {
+	cfg := owsConfig
+	cfg.DerivedValues = true
+	cfg.Altitude = 500
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+	err = svc.UpdatePropertyValues(false)
+	require.NoError(t, err)
+
+	// the EDS0068 reports the dew point itself, so only the absolute humidity and sea level
+	// pressure are derived
+	var properties map[string]interface{}
+	for _, msg := range out.Messages(dryrun.MessageTypeTD) {
+		if msg.DeviceID == counterRomID {
+			td, _ := msg.Data.(map[string]interface{})
+			properties, _ = td["properties"].(map[string]interface{})
+		}
+	}
+	require.NotNil(t, properties)
+	getAtType := func(propName string) interface{} {
+		prop, _ := properties[propName].(map[string]interface{})
+		require.NotNil(t, prop, propName)
+		return prop["@type"]
+	}
+	assert.Equal(t, eds.SarefNamespace+"Humidity", getAtType(internal.PropNameAbsoluteHumidity))
+	assert.Equal(t, eds.SarefNamespace+"Pressure", getAtType(internal.PropNameSeaLevelPressure))
+	assert.Equal(t, eds.SarefNamespace+"Temperature", getAtType(vocab.PropNameTemperature))
+
+	derivedProp, _ := properties[internal.PropNameDerivedProperties].(map[string]interface{})
+	require.NotNil(t, derivedProp)
+	assert.Equal(t, "absoluteHumidity,seaLevelPressure", derivedProp["const"])
+
+	published := false
+	for _, msg := range out.Messages(dryrun.MessageTypeProperties) {
+		values, _ := msg.Data.(map[string]interface{})
+		if msg.DeviceID == counterRomID && values[internal.PropNameDerivedProperties] != nil {
+			assert.Equal(t, "absoluteHumidity,seaLevelPressure", values[internal.PropNameDerivedProperties])
+			published = true
+		}
+	}
+	assert.True(t, published)
+}
+
+func TestNoDerivedAffordances(t *testing.T) {
+	svc, out := startDryRun(t, owsConfig)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+
+	for _, msg := range out.Messages(dryrun.MessageTypeTD) {
+		td, _ := msg.Data.(map[string]interface{})
+		properties, _ := td["properties"].(map[string]interface{})
+		assert.NotContains(t, properties, internal.PropNameDerivedProperties)
+	}
+}
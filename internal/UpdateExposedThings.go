@@ -2,41 +2,92 @@ package internal
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/tddiff"
 	"github.com/wostzone/wost-go/pkg/exposedthing"
 	"github.com/wostzone/wost-go/pkg/thing"
 	"github.com/wostzone/wost-go/pkg/vocab"
 )
 
 // CreateTDFromNode converts the node into a TD that describes the node.
-// - All attributes will be added as node properties
+// The TD is instantiated from the Thing Model of the node's device family, see CreateThingModel,
+// and extended with the affordances that depend on the device configuration:
+// - Numeric sensors have read-only properties with their statistics.
+// - Numeric sensors have a writable configuration property with their calibration.
+// - Numeric sensors have a read-only property with the quality of their last reading.
+// - Filtered sensors have a read-only property with their unfiltered value, if enabled.
+// - Pulse counters are added as read-only total and rate properties.
+// - Derived values, if enabled, are added as read-only properties.
+// - The title and description are taken from the device metadata if set, and the name and
+//   location are writable properties.
+// - The thingModel property holds the file name of the Thing Model of the device family.
+// - The gateway lists its devices per bus channel and the devices link back to the gateway.
+// The TD is rebuilt every TD interval to detect changes to the node.
+func (pb *OWServerPB) CreateTDFromNode(node *eds.OneWireNode) (tdoc *thing.ThingTD) {
+	thingID := pb.GetThingID(node)
+	nodeMetadata := pb.GetNodeMetadata(node)
+	tdoc = thing.CreateTD(thingID, nodeMetadata.Title, node.DeviceType)
+	tdoc.UpdateTitleDescription(nodeMetadata.Title, nodeMetadata.Description)
+	pb.CreateThingModel(node).Instantiate(tdoc)
+	AddThingModelAffordance(tdoc)
+	AddMetadataAffordances(tdoc, node)
+	pb.AddTopologyAffordances(tdoc, node)
+
+	hasValidation := false
+	for attrName, attr := range node.Attr {
+		if attr.IsCounter {
+			pb.AddCounterAffordances(tdoc, node.NodeID, attrName)
+		} else if attr.IsSensor {
+			pb.AddStatisticsAffordances(tdoc, attrName, attr)
+			AddCalibrationAffordance(tdoc, attrName, attr)
+			if IsValidated(attr) {
+				hasValidation = true
+				AddValidationAffordances(tdoc, attrName, attr)
+			}
+			pb.AddFilterAffordances(tdoc, node.NodeID, attrName, attr)
+		}
+	}
+	if hasValidation {
+		AddRejectedReadingsAffordance(tdoc)
+	}
+	pb.AddDerivedAffordances(tdoc, node)
+	return
+}
+
+// AddAttributeAffordances adds the affordances of the node attributes to a TD
+// - All attributes will be added as node properties, except for pulse counters
+// - Known attributes have a description, range or enum, and sensors have a semantic @type
 // - Writable non-sensors attributes are marked as writable configuration
 // - Sensors are also added as events.
 // - Writable sensors are also added as actions.
-// This is only used when a new Exposed Thing is created
-func (pb *OWServerPB) CreateTDFromNode(node *eds.OneWireNode) (tdoc *thing.ThingTD) {
-	thingID := thing.CreatePublisherID(pb.zone, PluginID, node.NodeID, node.DeviceType)
-	tdoc = thing.CreateTD(thingID, node.Name, node.DeviceType)
-	tdoc.UpdateTitleDescription(node.Name, node.Description)
-
-	// Map node attribute to Thing properties
+// This returns true if the node has sensors.
+func AddAttributeAffordances(tdoc *thing.ThingTD, node *eds.OneWireNode) (hasSensors bool) {
 	for attrName, attr := range node.Attr {
+		if attr.IsCounter {
+			continue
+		}
 		prop := tdoc.AddProperty(attrName, attr.Name, attr.DataType)
 		prop.Unit = attr.Unit
+		applyAttrInfo(&prop.DataSchema, attr.Info)
 
 		// sensors are added as both properties and events
 		if attr.IsSensor {
+			hasSensors = true
 			// sensors emit events
 			evAff := tdoc.AddEvent(attrName, attrName, attr.DataType)
 			evAff.Data.Unit = prop.Unit
+			applyAttrInfo(&evAff.Data, attr.Info)
 
 			// writable sensors are actuators and can be triggered with actions
 			if attr.Writable {
 				actionAff := tdoc.AddAction(attrName, attrName, attr.DataType)
 				actionAff.Input.Unit = prop.Unit
+				applyAttrInfo(&actionAff.Input, attr.Info)
 			}
 		} else {
 			// non-sensors are attributes. Writable attributes are configuration.
@@ -47,34 +98,121 @@ func (pb *OWServerPB) CreateTDFromNode(node *eds.OneWireNode) (tdoc *thing.Thing
 			}
 		}
 	}
-	return
+	return hasSensors
+}
+
+// applyAttrInfo adds the description, semantic type and constraints of an attribute to its schema
+func applyAttrInfo(schema *thing.DataSchema, info eds.AttrInfo) {
+	schema.Description = info.Description
+	schema.AtType = info.AtType
+	if info.HasRange() {
+		schema.NumberMinimum = info.Minimum
+		schema.NumberMaximum = info.Maximum
+	}
+	schema.Enum = info.Enum
 }
 
 // CreateExposedThingFromNode ensures that an exposed thing exists for the onewire node
-// This updates the schema.
+// This updates the schema. If the TD of an existing exposed thing has changed, eg after a
+// firmware update, the exposed thing is recreated to republish its TD with an updated
+// modified timestamp. Unchanged TDs are not republished.
+// If legacy Thing IDs are enabled, the node is also exposed under its legacy Thing ID as a
+// deprecated alias. The alias is removed when the transition period ends.
 func (pb *OWServerPB) CreateExposedThingFromNode(node *eds.OneWireNode) {
-	//eThing, found := pb.eThings[node.NodeID]
-	//if !found {
 	tdoc := pb.CreateTDFromNode(node)
-	eThing, found := pb.eFactory.Expose(node.NodeID, tdoc)
-	if !found {
+
+	pb.mu.Lock()
+	pb.nodeInfo[node.NodeID] = node
+	pb.mu.Unlock()
+	pb.exposeNodeTD(node, tdoc, pb.eThings, pb.tdFingerprints)
+
+	legacyID := pb.GetLegacyThingID(node)
+	if legacyID != "" {
+		pb.exposeNodeTD(node, pb.CreateAliasTD(node, tdoc, legacyID), pb.aliasThings, pb.aliasFingerprints)
+		return
+	}
+	pb.exposeMu.Lock()
+	defer pb.exposeMu.Unlock()
+	pb.mu.Lock()
+	aliasThing, found := pb.aliasThings[node.NodeID]
+	delete(pb.aliasThings, node.NodeID)
+	delete(pb.aliasFingerprints, node.NodeID)
+	pb.mu.Unlock()
+	if found {
+		logrus.Infof("Removing legacy Thing ID '%s' of device '%s'",
+			aliasThing.GetThingDescription().GetID(), node.NodeID)
+		pb.eFactory.Destroy(aliasThing)
+	}
+}
+
+// exposeNodeTD exposes the TD of a node, or re-exposes it if its fingerprint has changed
+// A re-exposed TD keeps the 'created' time of the previous TD and has a new 'modified' time.
+// The TD has no version property, so the modified time is what tells consumers it changed.
+// Comparing, destroying and exposing is serialized with exposeMu as this runs from several
+// goroutines, eg the heartbeat and the service actions.
+//  eThings is the map of node ID to exposed things to update
+//  fingerprints is the map of node ID to TD fingerprints to update
+func (pb *OWServerPB) exposeNodeTD(node *eds.OneWireNode, tdoc *thing.ThingTD,
+	eThings map[string]*exposedthing.ExposedThing, fingerprints map[string]string) {
+
+	fingerprint := tddiff.Fingerprint(tdoc)
+	pb.exposeMu.Lock()
+	defer pb.exposeMu.Unlock()
+	pb.mu.Lock()
+	eThing, found := eThings[node.NodeID]
+	oldFingerprint := fingerprints[node.NodeID]
+	pb.mu.Unlock()
+	if found {
+		if fingerprint == oldFingerprint {
+			return
+		}
+		oldTD := eThing.GetThingDescription()
+		// an empty fingerprint forces republishing of an unchanged TD
+		if oldFingerprint != "" {
+			logrus.Infof("TD of device '%s' has changed: %s",
+				node.NodeID, strings.Join(tddiff.Diff(oldTD, tdoc), "; "))
+		}
+		if oldTD.ID == tdoc.ID {
+			tdoc.Created = oldTD.Created
+		}
+		pb.eFactory.Destroy(eThing)
+	}
+	eThing, exists := pb.eFactory.Expose(node.NodeID, tdoc)
+	if !exists {
+		pb.CountPublications(eThing)
 		eThing.SetPropertyWriteHandler("", pb.HandleConfigRequest)
 		eThing.SetActionHandler("", pb.HandleActionRequest)
-		pb.mu.Lock()
-		pb.eThings[node.NodeID] = eThing
-		pb.mu.Unlock()
+		eThing.SetActionHandler(ActionNameGetHistory, pb.HandleHistoryRequest)
+		for _, propName := range []string{vocab.PropNameName, vocab.PropNameLocation} {
+			if _, found := node.Attr[propName]; !found {
+				eThing.SetPropertyWriteHandler(propName, pb.HandleMetadataRequest)
+			}
+		}
+		for attrName, attr := range node.Attr {
+			if IsCalibrated(attr) {
+				eThing.SetPropertyWriteHandler(CalibrationPropName(attrName), pb.HandleCalibrationRequest)
+			}
+		}
 	}
-	//} else {
-	//	// Node metadata doesn't change
-	//	_ = eThing.Expose()
-	//}
+	pb.mu.Lock()
+	eThings[node.NodeID] = eThing
+	fingerprints[node.NodeID] = fingerprint
+	pb.mu.Unlock()
 }
 
 // CreateExposedThingForService creates the Thing Description document of the service itself
 // and exposes it.
 //
-// TD attributes of this service includes are:
-//    'address' - gateway address
+// TD configuration of this service, which can be changed without restart, are:
+//    'gatewayAddress' - gateway address
+//    'valueInterval' and 'tdInterval' - polling intervals
+//    'logLevel' - logging level
+//    'deadbands' - minimum change of sensor values to publish
+// TD attributes of this service are its health and performance metrics, see AddMetricsAffordances.
+// TD actions of this service are:
+//    'replaceDevice' - move the Thing ID and state of a replaced device to its replacement
+//    'rediscover', 'refresh', 'republishTDs', 'resetStatistics' and 'dumpSnapshot' - maintenance
+// The result of actions is reported with the 'actionStatus' event.
 func (pb *OWServerPB) CreateExposedThingForService() *exposedthing.ExposedThing {
 	deviceType := vocab.DeviceTypeService
 	thingID := thing.CreatePublisherID(pb.zone, pb.Config.ClientID, pb.Config.ClientID, deviceType)
@@ -86,7 +224,10 @@ func (pb *OWServerPB) CreateExposedThingForService() *exposedthing.ExposedThing
 		"This service publishes information on The EDS OWServer 1-wire gateway and its connected sensors")
 
 	// Include the service properties (attributes and configuration)
-	tdoc.AddProperty(vocab.PropNameGatewayAddress, "Gateway Address", vocab.WoTDataTypeString)
+	AddServiceConfigAffordances(tdoc)
+	AddReplaceDeviceAffordance(tdoc)
+	AddServiceActionAffordances(tdoc)
+	AddMetricsAffordances(tdoc)
 
 	eThing, found := pb.eFactory.Expose(pb.Config.ClientID, tdoc)
 	if !found {
@@ -94,11 +235,10 @@ func (pb *OWServerPB) CreateExposedThingForService() *exposedthing.ExposedThing
 		pb.eThings[pb.Config.ClientID] = eThing
 		pb.mu.Unlock()
 
-		eThing.SetPropertyWriteHandler("",
-			func(eThing *exposedthing.ExposedThing, propName string, value *thing.InteractionOutput) error {
-				// TODO: add handle configuration changes (once there are any)
-				return nil
-			})
+		pb.CountPublications(eThing)
+		eThing.SetPropertyWriteHandler("", pb.HandleServiceConfigRequest)
+		eThing.SetActionHandler("", pb.HandleServiceActionRequest)
+		eThing.SetActionHandler(ActionNameReplaceDevice, pb.HandleReplaceDeviceRequest)
 	}
 	return eThing
 }
@@ -116,7 +256,9 @@ func (pb *OWServerPB) UpdateExposedThings() (err error) {
 		return err
 	}
 
+	startTime := time.Now()
 	rootNode, err := pb.edsAPI.ReadEds()
+	pb.metrics.RecordPoll(time.Since(startTime), startTime, err)
 	if err != nil {
 		// if pb.gatewayInfo.thingTD != nil {
 		// 	// The EDS cannot be reached. Set its error status
@@ -125,6 +267,8 @@ func (pb *OWServerPB) UpdateExposedThings() (err error) {
 		return err
 	}
 	nodeList := pb.edsAPI.ParseOneWireNodes(rootNode, 0, true)
+	pb.UpdateTopology(nodeList)
+	pb.UpdateSnapshot(nodeList, time.Now())
 
 	for _, node := range nodeList {
 		pb.CreateExposedThingFromNode(node)
@@ -0,0 +1,42 @@
+package internal_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+func TestConcurrentRepublish(t *testing.T) {
+	svc, out := startDryRun(t, owsConfig)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+
+	// republishing from several goroutines must leave exactly one exposed thing per device
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = svc.RepublishTDs()
+		}()
+	}
+	wg.Wait()
+
+	exposed := make(map[string]int)
+	for _, msg := range out.Messages("") {
+		if msg.Type == dryrun.MessageTypeTD {
+			exposed[msg.ThingID]++
+		} else if msg.Type == dryrun.MessageTypeDestroy {
+			exposed[msg.ThingID]--
+		}
+	}
+	assert.NotEmpty(t, exposed)
+	for thingID, count := range exposed {
+		assert.Equal(t, 1, count, thingID)
+	}
+}
@@ -0,0 +1,64 @@
+// Package internal handles smoothing of noisy sensor values
+package internal
+
+import (
+	"strconv"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/filters"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// FiltersConfig with the smoothing filters of sensors
+type FiltersConfig struct {
+	// Sensors with filters by sensor property name, eg humidity
+	Sensors map[string]filters.Config `yaml:"sensors,omitempty"`
+	// Devices with filters by ROM ID and property name. These override the sensor filters.
+	Devices map[string]map[string]filters.Config `yaml:"devices,omitempty"`
+}
+
+// RawPropName returns the name of the property that holds the unfiltered value of a sensor,
+// eg humidityRaw
+func RawPropName(sensorName string) string {
+	return sensorName + "Raw"
+}
+
+// AddFilterAffordances adds the read-only raw value property of a filtered sensor if enabled
+func (pb *OWServerPB) AddFilterAffordances(tdoc *thing.ThingTD, nodeID string, attrName string, attr eds.OneWireAttr) {
+	config, found := pb.filters.GetConfig(nodeID, attrName)
+	if !found || !config.PublishRaw || attr.DataType != vocab.WoTDataTypeNumber {
+		return
+	}
+	prop := tdoc.AddProperty(RawPropName(attrName), attr.Name+" unfiltered", vocab.WoTDataTypeNumber)
+	prop.Description = "Sensor value before the " + config.Type + " filter is applied"
+	prop.Unit = attr.Unit
+	prop.ReadOnly = true
+}
+
+// ApplyFilter returns the sensor attribute with its filtered value
+// If enabled, the unfiltered value is added to the property values.
+func (pb *OWServerPB) ApplyFilter(nodeID string, attrName string, attr eds.OneWireAttr,
+	propValues map[string]interface{}) eds.OneWireAttr {
+
+	if !attr.IsSensor || attr.DataType != vocab.WoTDataTypeNumber {
+		return attr
+	}
+	value, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return attr
+	}
+	filtered, hasFilter := pb.filters.Apply(nodeID, attrName, value)
+	if !hasFilter {
+		return attr
+	}
+	if config, _ := pb.filters.GetConfig(nodeID, attrName); config.PublishRaw {
+		propValues[RawPropName(attrName)] = attr.Value
+	}
+	if attr.Decimals >= 0 {
+		attr.Value = eds.FormatValue(filtered, attr.Decimals)
+	} else {
+		attr.Value = strconv.FormatFloat(filtered, 'f', -1, 64)
+	}
+	return attr
+}
@@ -0,0 +1,140 @@
+// Package internal handles the persisted inventory of known nodes
+package internal
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/inventory"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Status property of nodes
+const (
+	// PropNameStatus is the name of the property with the status of a node
+	PropNameStatus = "status"
+	// PropNameLastSeen is the name of the property with the time a node last reported its values
+	PropNameLastSeen = "lastSeen"
+	// StatusOnline indicates the node values are current
+	StatusOnline = "online"
+	// StatusStale indicates the node did not report its values in the last poll and its
+	// values are the last known values
+	StatusStale = "stale"
+)
+
+// AddStatusAffordances adds the read-only status and last seen properties of a node
+func AddStatusAffordances(tdoc *thing.ThingTD) {
+	prop := tdoc.AddProperty(PropNameStatus, "Status", vocab.WoTDataTypeString)
+	prop.Description = "'" + StatusStale + "' when the gateway did not report the node in the last poll " +
+		"and the values are the last known values"
+	prop.Enum = []interface{}{StatusOnline, StatusStale}
+	prop.ReadOnly = true
+	prop = tdoc.AddProperty(PropNameLastSeen, "Last seen", vocab.WoTDataTypeDateTime)
+	prop.Description = "Time the node last reported its values"
+	prop.ReadOnly = true
+}
+
+// UpdateInventory adds the online status of a polled node to its property values and
+// records the node and its values in the inventory.
+func (pb *OWServerPB) UpdateInventory(
+	node *eds.OneWireNode, propValues map[string]interface{}, timestamp time.Time) {
+
+	propValues[PropNameStatus] = StatusOnline
+	propValues[PropNameLastSeen] = timestamp.Format(vocab.TimeFormat)
+	pb.inventory.Update(node, propValues, timestamp)
+}
+
+// GetStaleValues returns the stale status of the known nodes that are not in the given
+// list of polled nodes.
+//  polled contains the IDs of the nodes that reported their values, nil if none did
+func (pb *OWServerPB) GetStaleValues(polled map[string](map[string]interface{})) map[string](map[string]interface{}) {
+	staleValues := make(map[string](map[string]interface{}))
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	for romID := range pb.nodeInfo {
+		if _, found := polled[romID]; !found {
+			staleValues[romID] = map[string]interface{}{PropNameStatus: StatusStale}
+		}
+	}
+	return staleValues
+}
+
+// RemoveNode removes a node from the inventory and destroys its exposed things
+// This is used for nodes that the gateway no longer reports, such as replaced devices.
+func (pb *OWServerPB) RemoveNode(romID string) {
+	pb.exposeMu.Lock()
+	defer pb.exposeMu.Unlock()
+	pb.inventory.Remove(romID)
+	pb.mu.Lock()
+	removed := make([]*exposedthing.ExposedThing, 0, 2)
+	if eThing, found := pb.eThings[romID]; found {
+		removed = append(removed, eThing)
+	}
+	if aliasThing, found := pb.aliasThings[romID]; found {
+		removed = append(removed, aliasThing)
+	}
+	delete(pb.nodeInfo, romID)
+	delete(pb.eThings, romID)
+	delete(pb.tdFingerprints, romID)
+	delete(pb.aliasThings, romID)
+	delete(pb.aliasFingerprints, romID)
+	pb.mu.Unlock()
+	for _, eThing := range removed {
+		pb.eFactory.Destroy(eThing)
+	}
+}
+
+// RemoveExpiredNodes removes the nodes that the gateway has not reported for longer than
+// the StaleNodeExpiry. This is called after a successful poll of the gateway.
+//  now is the time of the poll
+// This returns the ROM IDs of the removed nodes.
+func (pb *OWServerPB) RemoveExpiredNodes(now time.Time) []string {
+	pb.mu.Lock()
+	expiry := time.Duration(pb.Config.StaleNodeExpiry) * time.Second
+	pb.mu.Unlock()
+	if expiry <= 0 {
+		return nil
+	}
+	romIDs := pb.inventory.GetExpired(now.Add(-expiry))
+	for _, romID := range romIDs {
+		logrus.Warningf("Removing device '%s' as the gateway has not reported it for %s", romID, expiry)
+		pb.RemoveNode(romID)
+	}
+	return romIDs
+}
+
+// ExposeInventory exposes the Things of the nodes from the previous session with their
+// last known values and a stale status. This publishes the Things while the gateway
+// cannot be reached. The Things are reconciled when the gateway is polled: nodes that the
+// gateway doesn't report are marked stale and removed after the StaleNodeExpiry.
+func (pb *OWServerPB) ExposeInventory() {
+	romIDs := pb.inventory.GetIDs()
+	if len(romIDs) == 0 {
+		return
+	}
+	logrus.Infof("Exposing %d nodes from the inventory", len(romIDs))
+	records := make(map[string]*inventory.NodeRecord)
+	nodeList := make([]*eds.OneWireNode, 0, len(romIDs))
+	for _, romID := range romIDs {
+		records[romID] = pb.inventory.Get(romID)
+		nodeList = append(nodeList, records[romID].Node)
+	}
+	pb.UpdateTopology(nodeList)
+
+	thingValues := make(map[string](map[string]interface{}))
+	for romID, record := range records {
+		pb.CreateExposedThingFromNode(record.Node)
+		propValues := make(map[string]interface{})
+		for name, value := range record.Values {
+			propValues[name] = value
+		}
+		propValues[PropNameStatus] = StatusStale
+		propValues[PropNameLastSeen] = record.LastSeen.Format(vocab.TimeFormat)
+		thingValues[romID] = propValues
+	}
+	_ = pb.PublishValues(thingValues, false)
+}
@@ -0,0 +1,32 @@
+package internal_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+func TestRemoveExpiredNodes(t *testing.T) {
+	svc, out := startDryRun(t, owsConfig)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+	err = svc.UpdatePropertyValues(false)
+	require.NoError(t, err)
+	assert.Empty(t, out.Messages(dryrun.MessageTypeDestroy))
+
+	// nodes that were just seen are not removed
+	removed := svc.RemoveExpiredNodes(time.Now())
+	assert.Empty(t, removed)
+
+	// nodes that were not seen for longer than the expiry are removed with their Things
+	later := time.Now().Add(time.Duration(svc.Config.StaleNodeExpiry+1) * time.Second)
+	removed = svc.RemoveExpiredNodes(later)
+	assert.NotEmpty(t, removed)
+	assert.Len(t, out.Messages(dryrun.MessageTypeDestroy), len(removed))
+	assert.Empty(t, svc.RemoveExpiredNodes(later))
+}
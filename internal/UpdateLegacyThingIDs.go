@@ -0,0 +1,85 @@
+// Package internal handles the migration from the legacy Thing IDs of devices
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+)
+
+// GetLegacyThingID returns the Thing ID of a node as published by previous versions of this
+// service, which used the default zone and the plugin ID instead of the service instance ID.
+// Previous versions had no logical IDs so the legacy ID is always based on the ROM ID.
+// This returns "" if legacy Thing IDs are not published or the legacy ID equals the Thing ID.
+func (pb *OWServerPB) GetLegacyThingID(node *eds.OneWireNode) string {
+	if !pb.IsLegacyThingIDsEnabled(time.Now()) {
+		return ""
+	}
+	legacyID := thing.CreatePublisherID("", PluginID, node.NodeID, node.DeviceType)
+	if legacyID == pb.GetThingID(node) {
+		return ""
+	}
+	return legacyID
+}
+
+// IsLegacyThingIDsEnabled returns true if devices are also published under their legacy
+// Thing ID at the given time. The transition period ends at the end of the legacyThingIDsUntil date.
+func (pb *OWServerPB) IsLegacyThingIDsEnabled(now time.Time) bool {
+	if !pb.Config.LegacyThingIDs {
+		return false
+	}
+	if pb.legacyIDsUntil.IsZero() {
+		return true
+	}
+	return now.Before(pb.legacyIDsUntil.AddDate(0, 0, 1))
+}
+
+// CreateAliasTD creates the TD of the deprecated alias of a node under its legacy Thing ID.
+// The alias has the same affordances as the node's TD and refers to the node's Thing ID.
+//  tdoc is the TD of the node
+//  legacyID is the Thing ID of the alias
+func (pb *OWServerPB) CreateAliasTD(node *eds.OneWireNode, tdoc *thing.ThingTD, legacyID string) *thing.ThingTD {
+	aliasTD := pb.CreateTDFromNode(node)
+	aliasTD.ID = legacyID
+	description := fmt.Sprintf("Deprecated alias of Thing '%s'", tdoc.ID)
+	if !pb.legacyIDsUntil.IsZero() {
+		description += fmt.Sprintf(", published until %s", pb.Config.LegacyThingIDsUntil)
+	}
+	description += "."
+	if tdoc.Description != "" {
+		description += " " + tdoc.Description
+	}
+	aliasTD.UpdateTitleDescription(tdoc.Title, description)
+	return aliasTD
+}
+
+// RemoveExpiredAliases destroys the deprecated aliases of all nodes once the transition
+// period has ended. This is called after a successful poll of the gateway.
+//  now is the time of the poll
+// This returns the ROM IDs of the nodes whose alias was removed.
+func (pb *OWServerPB) RemoveExpiredAliases(now time.Time) []string {
+	if pb.IsLegacyThingIDsEnabled(now) {
+		return nil
+	}
+	pb.exposeMu.Lock()
+	defer pb.exposeMu.Unlock()
+	pb.mu.Lock()
+	aliasThings := pb.aliasThings
+	pb.aliasThings = make(map[string]*exposedthing.ExposedThing)
+	pb.aliasFingerprints = make(map[string]string)
+	pb.mu.Unlock()
+
+	romIDs := make([]string, 0, len(aliasThings))
+	for romID, aliasThing := range aliasThings {
+		logrus.Infof("Removing legacy Thing ID '%s' of device '%s'",
+			aliasThing.GetThingDescription().GetID(), romID)
+		pb.eFactory.Destroy(aliasThing)
+		romIDs = append(romIDs, romID)
+	}
+	return romIDs
+}
@@ -0,0 +1,118 @@
+package internal_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+	"github.com/wostzone/owserver/internal/metadata"
+)
+
+func TestGetLegacyThingID(t *testing.T) {
+	node := newTopologyNode("device1", vocab.DeviceTypeSensor, "1")
+	cfg := owsConfig
+	cfg.LegacyThingIDs = true
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	legacyID := svc.GetLegacyThingID(node)
+	assert.Equal(t, thing.CreatePublisherID("", internal.PluginID, node.NodeID, node.DeviceType), legacyID)
+	assert.NotEqual(t, svc.GetThingID(node), legacyID)
+
+	// no alias if the Thing ID didn't change
+	cfg.ClientID = internal.PluginID
+	cfg.Zone = ""
+	svc = internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	assert.Empty(t, svc.GetLegacyThingID(node))
+
+	// the legacy ID of a device with a logical ID is based on its ROM ID
+	cfg = owsConfig
+	cfg.LegacyThingIDs = true
+	cfg.Devices = map[string]metadata.DeviceMetadata{node.NodeID: {LogicalID: "boiler-supply"}}
+	svc = internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	assert.Contains(t, svc.GetThingID(node), "boiler-supply")
+	assert.Equal(t, thing.CreatePublisherID("", internal.PluginID, node.NodeID, node.DeviceType),
+		svc.GetLegacyThingID(node))
+
+	// no alias if legacy Thing IDs are not enabled
+	svc = internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	assert.Empty(t, svc.GetLegacyThingID(node))
+}
+
+func TestIsLegacyThingIDsEnabled(t *testing.T) {
+	cfg := owsConfig
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	assert.False(t, svc.IsLegacyThingIDsEnabled(time.Now()))
+
+	cfg.LegacyThingIDs = true
+	svc = internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	assert.True(t, svc.IsLegacyThingIDsEnabled(time.Now().AddDate(100, 0, 0)), "no end date")
+
+	// the end date is included until midnight
+	cfg.LegacyThingIDsUntil = "2022-10-30"
+	svc = internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	assert.True(t, svc.IsLegacyThingIDsEnabled(time.Date(2022, 10, 29, 12, 0, 0, 0, time.Local)))
+	assert.True(t, svc.IsLegacyThingIDsEnabled(time.Date(2022, 10, 30, 0, 0, 0, 0, time.Local)))
+	assert.True(t, svc.IsLegacyThingIDsEnabled(time.Date(2022, 10, 30, 23, 59, 59, 0, time.Local)))
+	assert.False(t, svc.IsLegacyThingIDsEnabled(time.Date(2022, 10, 31, 0, 0, 0, 0, time.Local)))
+}
+
+func TestCreateAliasTD(t *testing.T) {
+	node := newTopologyNode("device1", vocab.DeviceTypeSensor, "1")
+	cfg := owsConfig
+	cfg.LegacyThingIDs = true
+	cfg.LegacyThingIDsUntil = "2999-12-31"
+	svc := internal.NewOWServerPB(cfg, "", 0, nil, nil)
+	tdoc := svc.CreateTDFromNode(node)
+	legacyID := svc.GetLegacyThingID(node)
+
+	aliasTD := svc.CreateAliasTD(node, tdoc, legacyID)
+	assert.Equal(t, legacyID, aliasTD.ID)
+	assert.Equal(t, tdoc.Title, aliasTD.Title)
+	assert.True(t, strings.HasPrefix(aliasTD.Description,
+		"Deprecated alias of Thing '"+tdoc.ID+"', published until 2999-12-31."), aliasTD.Description)
+	for propName := range tdoc.Properties {
+		assert.NotNil(t, aliasTD.GetProperty(propName))
+	}
+}
+
+func TestRemoveExpiredAliases(t *testing.T) {
+	cfg := owsConfig
+	cfg.LegacyThingIDs = true
+	cfg.LegacyThingIDsUntil = "2999-12-31"
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+	err := svc.UpdateExposedThings()
+	require.NoError(t, err)
+
+	// each node is exposed under both Thing IDs
+	aliasIDs := make(map[string]bool)
+	for _, msg := range out.Messages(dryrun.MessageTypeTD) {
+		td, _ := msg.Data.(map[string]interface{})
+		description, _ := td["description"].(string)
+		if strings.HasPrefix(description, "Deprecated alias") {
+			aliasIDs[msg.ThingID] = true
+		}
+	}
+	require.NotEmpty(t, aliasIDs)
+	assert.Len(t, out.Messages(dryrun.MessageTypeTD), 2*len(aliasIDs))
+
+	removed := svc.RemoveExpiredAliases(time.Date(2999, 12, 31, 23, 0, 0, 0, time.Local))
+	assert.Empty(t, removed)
+	assert.Empty(t, out.Messages(dryrun.MessageTypeDestroy))
+
+	// the aliases are destroyed once the period expires
+	removed = svc.RemoveExpiredAliases(time.Date(3000, 1, 1, 0, 0, 0, 0, time.Local))
+	assert.Len(t, removed, len(aliasIDs))
+	destroyed := out.Messages(dryrun.MessageTypeDestroy)
+	require.Len(t, destroyed, len(aliasIDs))
+	for _, msg := range destroyed {
+		assert.True(t, aliasIDs[msg.ThingID], "'%s' is not an alias", msg.ThingID)
+	}
+	assert.Empty(t, svc.RemoveExpiredAliases(time.Date(3000, 1, 1, 0, 0, 0, 0, time.Local)))
+}
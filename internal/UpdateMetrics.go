@@ -0,0 +1,126 @@
+// Package internal handles the health and performance metrics of the service
+package internal
+
+import (
+	"time"
+
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Metrics properties of the service Thing
+const (
+	PropNamePollSuccessCount  = "pollSuccessCount"
+	PropNamePollFailureCount  = "pollFailureCount"
+	PropNamePollLatencyP50    = "pollLatencyP50"
+	PropNamePollLatencyP90    = "pollLatencyP90"
+	PropNamePollLatencyP99    = "pollLatencyP99"
+	PropNameLastPollTime      = "lastPollTime"
+	PropNameThingsExposed     = "thingsExposed"
+	PropNameMessagesPerMinute = "messagesPerMinute"
+	PropNameWriteSuccessCount = "writeSuccessCount"
+	PropNameWriteFailureCount = "writeFailureCount"
+	PropNameUptime            = "uptime"
+)
+
+// AddMetricsAffordances adds the read-only metrics properties to the service TD
+func AddMetricsAffordances(tdoc *thing.ThingTD) {
+	metricsProps := []struct {
+		name, title, dataType, unit, description string
+	}{
+		{PropNamePollSuccessCount, "Successful polls", vocab.WoTDataTypeInteger, "",
+			"Number of successful polls of the gateway since the start"},
+		{PropNamePollFailureCount, "Failed polls", vocab.WoTDataTypeInteger, "",
+			"Number of failed polls of the gateway since the start"},
+		{PropNamePollLatencyP50, "Poll latency median", vocab.WoTDataTypeNumber, "ms",
+			"Median latency of the recent polls of the gateway"},
+		{PropNamePollLatencyP90, "Poll latency 90th percentile", vocab.WoTDataTypeNumber, "ms",
+			"90th percentile latency of the recent polls of the gateway"},
+		{PropNamePollLatencyP99, "Poll latency 99th percentile", vocab.WoTDataTypeNumber, "ms",
+			"99th percentile latency of the recent polls of the gateway"},
+		{PropNameLastPollTime, "Last successful poll", vocab.WoTDataTypeDateTime, "",
+			"Time of the last successful poll of the gateway"},
+		{PropNameThingsExposed, "Things exposed", vocab.WoTDataTypeInteger, "",
+			"Number of Things published by the service"},
+		{PropNameMessagesPerMinute, "Messages per minute", vocab.WoTDataTypeInteger, "",
+			"Number of messages published over the last minute"},
+		{PropNameWriteSuccessCount, "Successful writes", vocab.WoTDataTypeInteger, "",
+			"Number of successful writes to devices since the start"},
+		{PropNameWriteFailureCount, "Failed writes", vocab.WoTDataTypeInteger, "",
+			"Number of rejected or failed writes to devices since the start"},
+		{PropNameUptime, "Uptime", vocab.WoTDataTypeInteger, vocab.UnitNameSecond,
+			"Time since the service started"},
+	}
+	for _, metricsProp := range metricsProps {
+		prop := tdoc.AddProperty(metricsProp.name, metricsProp.title, metricsProp.dataType)
+		prop.Description = metricsProp.description
+		prop.Unit = metricsProp.unit
+		prop.ReadOnly = true
+	}
+}
+
+// GetMetricsValues returns the metrics property values of the service Thing
+func (pb *OWServerPB) GetMetricsValues() map[string]interface{} {
+	pb.mu.Lock()
+	pb.metrics.SetThingsExposed(len(pb.eThings) + len(pb.aliasThings))
+	pb.mu.Unlock()
+	snapshot := pb.metrics.GetSnapshot(time.Now())
+	lastPollTime := ""
+	if !snapshot.LastPollTime.IsZero() {
+		lastPollTime = snapshot.LastPollTime.Format(vocab.TimeFormat)
+	}
+	return map[string]interface{}{
+		PropNamePollSuccessCount:  snapshot.PollSuccessCount,
+		PropNamePollFailureCount:  snapshot.PollFailureCount,
+		PropNamePollLatencyP50:    snapshot.LatencyP50,
+		PropNamePollLatencyP90:    snapshot.LatencyP90,
+		PropNamePollLatencyP99:    snapshot.LatencyP99,
+		PropNameLastPollTime:      lastPollTime,
+		PropNameThingsExposed:     snapshot.ThingsExposed,
+		PropNameMessagesPerMinute: snapshot.MessagesPerMinute,
+		PropNameWriteSuccessCount: snapshot.WriteSuccessCount,
+		PropNameWriteFailureCount: snapshot.WriteFailureCount,
+		PropNameUptime:            int(snapshot.Uptime.Seconds()),
+	}
+}
+
+// PublishMetrics publishes the changed metrics on the service Thing, if it is published
+func (pb *OWServerPB) PublishMetrics() error {
+	pb.mu.Lock()
+	serviceEThing := pb.serviceEThing
+	pb.mu.Unlock()
+	if serviceEThing == nil {
+		return nil
+	}
+	return serviceEThing.EmitPropertiesChange(pb.GetMetricsValues(), true)
+}
+
+// CountPublications installs hooks on an exposed thing that count its published messages
+// and failed publications for the metrics.
+func (pb *OWServerPB) CountPublications(eThing *exposedthing.ExposedThing) {
+	emitEvent := eThing.EmitEventHook
+	emitPropertiesChange := eThing.EmitPropertiesChangeHook
+	if emitEvent != nil {
+		eThing.EmitEventHook = func(name string, data interface{}) error {
+			err := emitEvent(name, data)
+			if err == nil {
+				pb.metrics.RecordMessages(1, time.Now())
+			} else {
+				pb.metrics.RecordPublishFailure()
+			}
+			return err
+		}
+	}
+	if emitPropertiesChange != nil {
+		eThing.EmitPropertiesChangeHook = func(props map[string]interface{}) error {
+			err := emitPropertiesChange(props)
+			if err == nil {
+				pb.metrics.RecordMessages(1, time.Now())
+			} else {
+				pb.metrics.RecordPublishFailure()
+			}
+			return err
+		}
+	}
+}
@@ -3,14 +3,21 @@ package internal
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/sirupsen/logrus"
-
 	"github.com/wostzone/wost-go/pkg/vocab"
 )
 
 // PollNodeValues obtains thing property values of each Thing and converts the EDS property
-// names to vocabulary names.
+// names to vocabulary names. Implausible sensor readings are replaced with the last good value.
+// Valid sensor values are calibrated, filtered and added to the history and statistics.
+// Changes of sensor values within their deadband are not published.
+// Pulse counters are converted to totals and rates. Derived values are added if enabled.
+// The device name, location and tags are added from the device metadata.
+// The links between the gateway and its devices are updated.
+// Polled nodes are recorded in the inventory and known nodes that are not polled are marked stale.
+// Deprecated aliases under legacy Thing IDs are removed when their transition period has ended.
 // This returns a map of device/node IDs containing a maps of property name-value pairs
 func (pb *OWServerPB) PollNodeValues() (nodeValues map[string](map[string]interface{}), err error) {
 
@@ -19,19 +26,81 @@ func (pb *OWServerPB) PollNodeValues() (nodeValues map[string](map[string]interf
 		logrus.Error(err)
 		return
 	}
-	nodeValues, err = pb.edsAPI.PollValues()
+	timestamp := time.Now()
+	nodeList, err := pb.edsAPI.PollNodes()
+	pb.metrics.RecordPoll(time.Since(timestamp), timestamp, err)
+	if err != nil {
+		return nil, err
+	}
+	if pb.UpdateTopology(nodeList) {
+		// the gateway TD has a property for each bus channel
+		for _, node := range nodeList {
+			if node.DeviceType == vocab.DeviceTypeGateway {
+				pb.CreateExposedThingFromNode(node)
+			}
+		}
+	}
+	pb.UpdateSnapshot(nodeList, timestamp)
+	nodeValues = make(map[string](map[string]interface{}))
+	for _, node := range nodeList {
+		propValues := make(map[string]interface{})
+		hasValidation := false
+		for name, attr := range node.Attr {
+			if attr.IsCounter {
+				pb.UpdateCounter(node.NodeID, name, attr, timestamp, propValues)
+				continue
+			}
+			quality := QualityGood
+			if IsValidated(attr) {
+				var hasValue bool
+				hasValidation = true
+				attr, quality, hasValue = pb.ValidateReading(node, name, attr)
+				propValues[QualityPropName(name)] = quality
+				if !hasValue {
+					continue
+				}
+			}
+			if IsCalibrated(attr) {
+				attr = pb.ApplyCalibration(node.NodeID, name, attr)
+				propValues[CalibrationPropName(name)] = pb.calibration.Get(node.NodeID, name)
+			}
+			if quality == QualityGood {
+				attr = pb.ApplyFilter(node.NodeID, name, attr, propValues)
+			}
+			propValues[name] = attr.Value
+			if attr.IsSensor && quality == QualityGood {
+				pb.AddHistory(node.NodeID, name, attr.Value, timestamp)
+				pb.UpdateStatistics(node.NodeID, name, attr, timestamp, propValues)
+				propValues[name] = pb.deadbands.Apply(node.NodeID, name, attr.Value)
+			}
+		}
+		if hasValidation {
+			propValues[PropNameRejectedReadings] = pb.validator.GetRejections(node.NodeID)
+		}
+		pb.UpdateDerivedValues(node, propValues)
+		pb.UpdateMetadataValues(node, propValues)
+		propValues[PropNameThingModel] = pb.GetThingModelFilename(node)
+		pb.UpdateTopologyValues(node, propValues)
+		pb.UpdateInventory(node, propValues, timestamp)
+		nodeValues[node.NodeID] = propValues
+	}
+	pb.RemoveExpiredNodes(timestamp)
+	pb.RemoveExpiredAliases(timestamp)
+	for romID, staleValues := range pb.GetStaleValues(nodeValues) {
+		nodeValues[romID] = staleValues
+	}
 	// update service properties if enabled
 	if pb.Config.PublishTD {
-		serviceProps := make(map[string]interface{})
-		serviceProps[vocab.PropNameGatewayAddress] = pb.edsAPI.GetLastAddress()
-		nodeValues[pb.Config.ClientID] = serviceProps
+		nodeValues[pb.Config.ClientID] = pb.GetServiceConfigValues()
 	}
 	return nodeValues, err
 }
 
 // PublishValues publishes updated thing property values of each TD
 // This takes a map of device IDs and properties [device IDs] (property map)
-//  and emits the properties as an update event.
+//  and emits the properties as an update event. Devices that are also published under their
+//  legacy Thing ID emit the properties under both Thing IDs.
+// A property that cannot be emitted doesn't stop the other values. This returns the first error.
 func (pb *OWServerPB) PublishValues(thingValues map[string](map[string]interface{}), onlyChanges bool) error {
 	if thingValues == nil {
 		err := errors.New("missing values")
@@ -39,16 +108,25 @@ func (pb *OWServerPB) PublishValues(thingValues map[string](map[string]interface
 		return err
 	}
 	logrus.Infof("%d things", len(thingValues))
+	var firstErr error
 	for deviceID, propValues := range thingValues {
 		pb.mu.Lock()
 		eThing, found := pb.eThings[deviceID]
+		aliasThing, hasAlias := pb.aliasThings[deviceID]
 		pb.mu.Unlock()
 		if found {
 			// submit each property in turn
 			for propName, newVal := range propValues {
 				err := eThing.EmitPropertyChange(propName, newVal, onlyChanges)
-				if err != nil {
-					return err
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				// the deprecated legacy Thing ID mirrors the values
+				if hasAlias {
+					err = aliasThing.EmitPropertyChange(propName, newVal, onlyChanges)
+					if err != nil && firstErr == nil {
+						firstErr = err
+					}
 				}
 			}
 
@@ -61,16 +139,18 @@ func (pb *OWServerPB) PublishValues(thingValues map[string](map[string]interface
 			logrus.Errorf("Device with ID %s has no Exposed Thing", deviceID)
 		}
 	}
-	return nil
+	return firstErr
 }
 
 // UpdatePropertyValues polls the OWServer hub for Thing property values and pass updates
-// to the Exposed Thing.
+// to the Exposed Thing. If the hub cannot be reached then all known nodes are marked stale.
 //  onlyChanges only submit changed values
 func (pb *OWServerPB) UpdatePropertyValues(onlyChanges bool) error {
 	nodeValueMap, err := pb.PollNodeValues()
 	if err == nil {
 		err = pb.PublishValues(nodeValueMap, onlyChanges)
+	} else {
+		_ = pb.PublishValues(pb.GetStaleValues(nil), true)
 	}
 	return err
 }
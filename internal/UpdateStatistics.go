@@ -0,0 +1,65 @@
+// Package internal with sensor statistics
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/stats"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// statNames are the names of the statistics collected for each numeric sensor
+var statNames = []struct {
+	name  string
+	title string
+}{
+	{name: "min", title: "minimum"},
+	{name: "max", title: "maximum"},
+	{name: "avg", title: "average"},
+}
+
+// AddStatisticsAffordances adds read-only properties for the statistics of a numeric sensor
+// to the TD. A property is added for each statistic of each configured window.
+func (pb *OWServerPB) AddStatisticsAffordances(tdoc *thing.ThingTD, attrName string, attr eds.OneWireAttr) {
+	if !attr.IsSensor || attr.DataType != vocab.WoTDataTypeNumber {
+		return
+	}
+	for _, window := range pb.stats.GetWindows() {
+		for _, stat := range statNames {
+			propName := stats.PropName(attrName, stat.name, window.Name)
+			title := fmt.Sprintf("%s %s (%s)", attr.Name, stat.title, window.Name)
+			prop := tdoc.AddProperty(propName, title, vocab.WoTDataTypeNumber)
+			prop.Unit = attr.Unit
+			prop.ReadOnly = true
+		}
+	}
+}
+
+// UpdateStatistics adds a numeric sensor value to the statistics and adds the updated
+// statistics to the property values of the node.
+func (pb *OWServerPB) UpdateStatistics(nodeID string, propName string, attr eds.OneWireAttr,
+	timestamp time.Time, propValues map[string]interface{}) {
+
+	if attr.DataType != vocab.WoTDataTypeNumber {
+		return
+	}
+	valueFloat, err := strconv.ParseFloat(attr.Value, 64)
+	if err != nil {
+		return
+	}
+	pb.stats.Add(nodeID, propName, valueFloat, timestamp)
+	// averages get one more decimal than the sensor value
+	decimals := attr.Decimals
+	if decimals < 0 {
+		decimals = 2
+	}
+	for _, windowStats := range pb.stats.Get(nodeID, propName) {
+		propValues[stats.PropName(propName, "min", windowStats.Window)] = eds.FormatValue(windowStats.Min, decimals)
+		propValues[stats.PropName(propName, "max", windowStats.Window)] = eds.FormatValue(windowStats.Max, decimals)
+		propValues[stats.PropName(propName, "avg", windowStats.Window)] = eds.FormatValue(windowStats.Avg, decimals+1)
+	}
+}
@@ -0,0 +1,102 @@
+// Package internal handles the Thing Models of device families
+package internal
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/thingmodel"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// PropNameThingModel is the name of the property with the file name of the Thing Model of a
+// device. It takes the place of the 'tm:extends' link as the TD has no links. The file name is
+// relative to the folder the models are exported to, so it is not a resolvable URI.
+const PropNameThingModel = "thingModel"
+
+// GatewayModelName is the model name of the OWServer gateway
+const GatewayModelName = "OWServer-V2"
+
+// GetModelName returns the name of the Thing Model of a node, eg DS18B20 or EDS0068
+func GetModelName(node *eds.OneWireNode) string {
+	if node.DeviceType == vocab.DeviceTypeGateway {
+		return GatewayModelName
+	}
+	if nameAttr, found := node.Attr["Name"]; found && nameAttr.Value != "" {
+		return nameAttr.Value
+	}
+	if familyAttr, found := node.Attr["Family"]; found {
+		return "family-" + familyAttr.Value
+	}
+	return node.Name
+}
+
+// AddThingModelAffordance adds the read-only property with the file name of the device Thing Model
+func AddThingModelAffordance(tdoc *thing.ThingTD) {
+	prop := tdoc.AddProperty(PropNameThingModel, "Thing Model", vocab.WoTDataTypeString)
+	prop.Description = "File name of the Thing Model of the device family, relative to the folder the models are exported to"
+	prop.ReadOnly = true
+}
+
+// CreateThingModel creates the Thing Model of the device family of a node
+// The model contains the affordances that don't depend on the configuration: the device
+// attributes and sensors, the status properties and the history action. The attributes are
+// those reported by the node. ExportThingModels merges the models of the devices of a family.
+func (pb *OWServerPB) CreateThingModel(node *eds.OneWireNode) *thingmodel.ThingModel {
+	modelName := GetModelName(node)
+	template := thing.CreateTD("", modelName, node.DeviceType)
+	hasSensors := AddAttributeAffordances(template, node)
+	AddStatusAffordances(template)
+	if hasSensors {
+		AddHistoryAffordances(template)
+	}
+	return thingmodel.NewThingModel(modelName, node.Description, template)
+}
+
+// GetThingModelFilename returns the file name of the exported Thing Model of a node
+func (pb *OWServerPB) GetThingModelFilename(node *eds.OneWireNode) string {
+	return thingmodel.ModelFilename(GetModelName(node))
+}
+
+// ExportThingModels reads the nodes from the gateway and saves the Thing Model of each
+// device family as a JSON-LD file in the given folder. Devices of a family with different
+// attributes share a single model in which the attributes that not all of them have are optional.
+// This returns the paths of the saved files.
+func (pb *OWServerPB) ExportThingModels(folder string) ([]string, error) {
+	rootNode, err := pb.edsAPI.ReadEds()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(folder, 0755)
+	if err != nil {
+		return nil, err
+	}
+	nodeList := pb.edsAPI.ParseOneWireNodes(rootNode, 0, true)
+	// models by family, in the order the families are found
+	models := make(map[string]*thingmodel.ThingModel)
+	families := make([]string, 0)
+	for _, node := range nodeList {
+		tm := pb.CreateThingModel(node)
+		if familyModel, found := models[tm.Title]; found {
+			familyModel.Merge(tm)
+			continue
+		}
+		models[tm.Title] = tm
+		families = append(families, tm.Title)
+	}
+	filePaths := make([]string, 0, len(families))
+	for _, family := range families {
+		tm := models[family]
+		filePath, err := tm.Save(folder)
+		if err != nil {
+			return filePaths, fmt.Errorf("failed saving Thing Model '%s': %s", tm.Title, err)
+		}
+		logrus.Infof("Exported Thing Model '%s' to '%s'", tm.Title, filePath)
+		filePaths = append(filePaths, filePath)
+	}
+	return filePaths, nil
+}
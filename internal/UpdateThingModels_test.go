@@ -0,0 +1,26 @@
+package internal_test
+
+import (
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/thingmodel"
+)
+
+func TestExportThingModels(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	folder := t.TempDir()
+	filePaths, err := svc.ExportThingModels(folder)
+	require.NoError(t, err)
+
+	// the two DS18B20 devices share the model of their family
+	assert.ElementsMatch(t, []string{
+		path.Join(folder, "DS18B20"+thingmodel.ModelFileExt),
+		path.Join(folder, "EDS0068"+thingmodel.ModelFileExt),
+		path.Join(folder, internal.GatewayModelName+thingmodel.ModelFileExt),
+	}, filePaths)
+}
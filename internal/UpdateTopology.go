@@ -0,0 +1,132 @@
+// Package internal handles the links between the gateway and its devices
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// Topology properties. The TD has no links, so these properties hold the Thing IDs of the
+// linked Things.
+const (
+	// PropNameGateway is the name of the device property with the Thing ID of its gateway
+	PropNameGateway = "gateway"
+	// PropNameDevices is the name of the gateway property with the Thing IDs of its devices
+	PropNameDevices = "devices"
+)
+
+// Topology of the gateway and its devices
+type Topology struct {
+	// GatewayThingID is the Thing ID of the gateway
+	GatewayThingID string
+	// Devices holds the sorted Thing IDs of all devices
+	Devices []string
+	// ChannelDevices holds the sorted Thing IDs of devices by gateway bus channel. Devices
+	// without a 'Channel' attribute are not included.
+	ChannelDevices map[string][]string
+}
+
+// hasSameChannels returns true if both topologies have the same bus channels
+func (topology Topology) hasSameChannels(other Topology) bool {
+	if len(topology.ChannelDevices) != len(other.ChannelDevices) {
+		return false
+	}
+	for channel := range topology.ChannelDevices {
+		if _, found := other.ChannelDevices[channel]; !found {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelPropName returns the name of the gateway property with the Thing IDs of the
+// devices on a bus channel, eg channel1Devices
+func ChannelPropName(channel string) string {
+	return "channel" + channel + "Devices"
+}
+
+// GetThingID returns the Thing ID of a node
+// The Thing ID includes the zone and the service instance ID, so the devices of multiple
+// instances don't collide: urn:{zone}:{clientID}:{logicalID}:{deviceType}
+func (pb *OWServerPB) GetThingID(node *eds.OneWireNode) string {
+	return thing.CreatePublisherID(pb.zone, pb.Config.ClientID, pb.GetLogicalID(node.NodeID), node.DeviceType)
+}
+
+// UpdateTopology determines the devices on each bus channel of the gateway
+// The gateway TD has a property for each bus channel, so it must be rebuilt when the
+// channels change.
+//  nodeList is the list of nodes read from the gateway, including the gateway itself
+// This returns true if the bus channels have changed.
+func (pb *OWServerPB) UpdateTopology(nodeList []*eds.OneWireNode) (channelsChanged bool) {
+	topology := Topology{
+		Devices:        make([]string, 0, len(nodeList)),
+		ChannelDevices: make(map[string][]string),
+	}
+	for _, node := range nodeList {
+		if node.DeviceType == vocab.DeviceTypeGateway {
+			topology.GatewayThingID = pb.GetThingID(node)
+			continue
+		}
+		thingID := pb.GetThingID(node)
+		topology.Devices = append(topology.Devices, thingID)
+		if channel := node.Attr["Channel"].Value; channel != "" {
+			topology.ChannelDevices[channel] = append(topology.ChannelDevices[channel], thingID)
+		}
+	}
+	sort.Strings(topology.Devices)
+	for _, thingIDs := range topology.ChannelDevices {
+		sort.Strings(thingIDs)
+	}
+	pb.mu.Lock()
+	channelsChanged = !topology.hasSameChannels(pb.topology)
+	pb.topology = topology
+	pb.mu.Unlock()
+	return channelsChanged
+}
+
+// GetTopology returns the last known topology of the gateway and its devices
+func (pb *OWServerPB) GetTopology() Topology {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	return pb.topology
+}
+
+// AddTopologyAffordances adds the properties that link a node to the gateway or its devices
+// The gateway lists its devices and the devices on each bus channel. Devices link back to the gateway.
+// Devices report their bus channel with the 'Channel' attribute. Devices without it are only
+// listed in the devices property.
+func (pb *OWServerPB) AddTopologyAffordances(tdoc *thing.ThingTD, node *eds.OneWireNode) {
+	if node.DeviceType != vocab.DeviceTypeGateway {
+		prop := tdoc.AddProperty(PropNameGateway, "Gateway", vocab.WoTDataTypeString)
+		prop.Description = "Thing ID of the gateway the device is connected to"
+		prop.Format = "uri"
+		prop.ReadOnly = true
+		return
+	}
+	prop := tdoc.AddProperty(PropNameDevices, "Devices", vocab.WoTDataTypeString)
+	prop.Description = "Comma separated Thing IDs of the devices connected to the gateway"
+	prop.ReadOnly = true
+	for channel := range pb.GetTopology().ChannelDevices {
+		prop = tdoc.AddProperty(ChannelPropName(channel), "Devices on channel "+channel, vocab.WoTDataTypeString)
+		prop.Description = fmt.Sprintf("Comma separated Thing IDs of the devices on bus channel %s", channel)
+		prop.ReadOnly = true
+	}
+}
+
+// UpdateTopologyValues adds the values of the topology properties of a node
+func (pb *OWServerPB) UpdateTopologyValues(node *eds.OneWireNode, propValues map[string]interface{}) {
+	topology := pb.GetTopology()
+	if node.DeviceType != vocab.DeviceTypeGateway {
+		propValues[PropNameGateway] = topology.GatewayThingID
+		return
+	}
+	for channel, thingIDs := range topology.ChannelDevices {
+		propValues[ChannelPropName(channel)] = strings.Join(thingIDs, ",")
+	}
+	propValues[PropNameDevices] = strings.Join(topology.Devices, ",")
+}
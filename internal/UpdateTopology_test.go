@@ -0,0 +1,148 @@
+package internal_test
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal"
+	"github.com/wostzone/owserver/internal/dryrun"
+	"github.com/wostzone/owserver/internal/eds"
+)
+
+// newTopologyNode creates a node on a bus channel, "" for a node without a 'Channel' attribute
+func newTopologyNode(romID string, deviceType vocab.DeviceType, channel string) *eds.OneWireNode {
+	node := &eds.OneWireNode{
+		DeviceType: deviceType,
+		NodeID:     romID,
+		Name:       "DS18B20",
+		Attr:       make(map[string]eds.OneWireAttr),
+	}
+	if channel != "" {
+		node.Attr["Channel"] = eds.OneWireAttr{Name: "Channel", Value: channel}
+	}
+	return node
+}
+
+func TestUpdateTopology(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	gateway := newTopologyNode("gateway", vocab.DeviceTypeGateway, "")
+	device1 := newTopologyNode("device1", vocab.DeviceTypeSensor, "1")
+	device2 := newTopologyNode("device2", vocab.DeviceTypeSensor, "2")
+	device3 := newTopologyNode("device3", vocab.DeviceTypeSensor, "2")
+
+	changed := svc.UpdateTopology([]*eds.OneWireNode{gateway, device3, device1, device2})
+	assert.True(t, changed)
+	topology := svc.GetTopology()
+	assert.Equal(t, svc.GetThingID(gateway), topology.GatewayThingID)
+	assert.Equal(t, []string{svc.GetThingID(device1), svc.GetThingID(device2), svc.GetThingID(device3)},
+		topology.Devices)
+	assert.Equal(t, []string{svc.GetThingID(device1)}, topology.ChannelDevices["1"])
+	assert.Equal(t, []string{svc.GetThingID(device2), svc.GetThingID(device3)}, topology.ChannelDevices["2"])
+
+	// moving a device between known channels keeps the channel properties
+	device3.Attr["Channel"] = eds.OneWireAttr{Name: "Channel", Value: "1"}
+	changed = svc.UpdateTopology([]*eds.OneWireNode{gateway, device1, device2, device3})
+	assert.False(t, changed)
+	assert.Len(t, svc.GetTopology().ChannelDevices["1"], 2)
+
+	// a device on a new channel changes the channel properties
+	device3.Attr["Channel"] = eds.OneWireAttr{Name: "Channel", Value: "3"}
+	changed = svc.UpdateTopology([]*eds.OneWireNode{gateway, device1, device2, device3})
+	assert.True(t, changed)
+	changed = svc.UpdateTopology([]*eds.OneWireNode{gateway, device1, device2})
+	assert.True(t, changed)
+}
+
+func TestUpdateTopologyValues(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	gateway := newTopologyNode("gateway", vocab.DeviceTypeGateway, "")
+	device1 := newTopologyNode("device1", vocab.DeviceTypeSensor, "1")
+	device2 := newTopologyNode("device2", vocab.DeviceTypeSensor, "2")
+	svc.UpdateTopology([]*eds.OneWireNode{gateway, device1, device2})
+
+	gatewayValues := make(map[string]interface{})
+	svc.UpdateTopologyValues(gateway, gatewayValues)
+	assert.Equal(t, map[string]interface{}{
+		internal.PropNameDevices:      svc.GetThingID(device1) + "," + svc.GetThingID(device2),
+		internal.ChannelPropName("1"): svc.GetThingID(device1),
+		internal.ChannelPropName("2"): svc.GetThingID(device2),
+	}, gatewayValues)
+
+	deviceValues := make(map[string]interface{})
+	svc.UpdateTopologyValues(device1, deviceValues)
+	assert.Equal(t, map[string]interface{}{internal.PropNameGateway: svc.GetThingID(gateway)}, deviceValues)
+
+	// the values match the properties of the TD
+	tdoc := thing.CreateTD(svc.GetThingID(gateway), "gateway", vocab.DeviceTypeGateway)
+	svc.AddTopologyAffordances(tdoc, gateway)
+	for propName := range gatewayValues {
+		assert.NotNil(t, tdoc.GetProperty(propName), "property '%s' is missing", propName)
+	}
+}
+
+func TestDeviceWithoutChannel(t *testing.T) {
+	svc := internal.NewOWServerPB(owsConfig, "", 0, nil, nil)
+	gateway := newTopologyNode("gateway", vocab.DeviceTypeGateway, "")
+	device1 := newTopologyNode("device1", vocab.DeviceTypeSensor, "")
+	svc.UpdateTopology([]*eds.OneWireNode{gateway, device1})
+
+	topology := svc.GetTopology()
+	assert.Empty(t, topology.ChannelDevices)
+	assert.Equal(t, []string{svc.GetThingID(device1)}, topology.Devices)
+
+	gatewayValues := make(map[string]interface{})
+	svc.UpdateTopologyValues(gateway, gatewayValues)
+	assert.NotContains(t, gatewayValues, internal.ChannelPropName(""))
+	assert.Equal(t, svc.GetThingID(device1), gatewayValues[internal.PropNameDevices])
+
+	tdoc := thing.CreateTD(svc.GetThingID(gateway), "gateway", vocab.DeviceTypeGateway)
+	svc.AddTopologyAffordances(tdoc, gateway)
+	assert.Nil(t, tdoc.GetProperty(internal.ChannelPropName("")))
+}
+
+func TestNewChannelRebuildsGatewayTD(t *testing.T) {
+	// poll a copy of the simulation file that is changed after exposing the Things
+	simData, err := ioutil.ReadFile(strings.TrimPrefix(owsSimulationFile, "file://"))
+	require.NoError(t, err)
+	simFile := path.Join(t.TempDir(), "owserver-details.xml")
+	err = ioutil.WriteFile(simFile, simData, 0600)
+	require.NoError(t, err)
+	cfg := owsConfig
+	cfg.EdsAddress = "file://" + simFile
+	svc, out := startDryRun(t, cfg)
+	defer svc.Stop()
+
+	err = svc.UpdateExposedThings()
+	require.NoError(t, err)
+	gatewayID := svc.GetTopology().GatewayThingID
+	tdCount := len(out.Messages(dryrun.MessageTypeTD))
+	assert.NotContains(t, svc.GetTopology().ChannelDevices, "4")
+
+	// move a device to a channel without devices
+	simData = []byte(strings.Replace(string(simData), "<Channel>3</Channel>", "<Channel>4</Channel>", 1))
+	err = ioutil.WriteFile(simFile, simData, 0600)
+	require.NoError(t, err)
+	err = svc.UpdatePropertyValues(false)
+	require.NoError(t, err, "all values have a property")
+
+	tdMessages := out.Messages(dryrun.MessageTypeTD)
+	require.Len(t, tdMessages, tdCount+1, "only the gateway TD is re-exposed")
+	assert.Equal(t, gatewayID, tdMessages[tdCount].ThingID)
+	found := false
+	for _, msg := range out.Messages(dryrun.MessageTypeProperties) {
+		if msg.ThingID == gatewayID {
+			values, _ := msg.Data.(map[string]interface{})
+			if _, hasValue := values[internal.ChannelPropName("4")]; hasValue {
+				found = true
+			}
+		}
+	}
+	assert.True(t, found, "the new channel is published")
+}
@@ -0,0 +1,90 @@
+// Package internal handles validation of sensor readings
+package internal
+
+import (
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/validation"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+// PropNameRejectedReadings is the name of the diagnostic property with the number of
+// rejected readings of a device
+const PropNameRejectedReadings = "rejectedReadings"
+
+// Quality of a sensor reading
+const (
+	QualityGood = "good"
+	QualityBad  = "bad"
+)
+
+// ValidationConfig with the plausible ranges and sentinel values of sensors
+type ValidationConfig struct {
+	// Families with rules by 1-wire family and property name. These override the default rules.
+	Families map[string]map[string]validation.Rule `yaml:"families,omitempty"`
+	// Devices with rules by ROM ID and property name. These override the family rules.
+	Devices map[string]map[string]validation.Rule `yaml:"devices,omitempty"`
+}
+
+// QualityPropName returns the name of the property that holds the quality of a sensor reading,
+// eg temperatureQuality
+func QualityPropName(sensorName string) string {
+	return sensorName + "Quality"
+}
+
+// IsValidated returns true if the attribute is a sensor whose readings are validated
+func IsValidated(attr eds.OneWireAttr) bool {
+	return attr.IsSensor && attr.DataType == vocab.WoTDataTypeNumber
+}
+
+// AddValidationAffordances adds the read-only quality property of a numeric sensor
+func AddValidationAffordances(tdoc *thing.ThingTD, attrName string, attr eds.OneWireAttr) {
+	if !IsValidated(attr) {
+		return
+	}
+	prop := tdoc.AddProperty(QualityPropName(attrName), attr.Name+" quality", vocab.WoTDataTypeString)
+	prop.Description = "Quality of the last reading. When 'bad', the reading was rejected and the " +
+		"last good value is held."
+	prop.Enum = []interface{}{QualityGood, QualityBad}
+	prop.ReadOnly = true
+}
+
+// AddRejectedReadingsAffordance adds the diagnostic property with the number of rejected readings
+func AddRejectedReadingsAffordance(tdoc *thing.ThingTD) {
+	prop := tdoc.AddProperty(PropNameRejectedReadings, "Rejected readings", vocab.WoTDataTypeInteger)
+	prop.Description = "Number of implausible sensor readings rejected since the service started"
+	prop.ReadOnly = true
+}
+
+// ValidateReading checks a raw sensor reading against the plausible range and sentinel values
+// of the sensor. A rejected reading is replaced with the last good value.
+// This returns the attribute with the good value and the quality of the reading.
+// hasValue is false if the reading is rejected and there is no last good value to hold.
+func (pb *OWServerPB) ValidateReading(node *eds.OneWireNode, attrName string, attr eds.OneWireAttr) (
+	goodAttr eds.OneWireAttr, quality string, hasValue bool) {
+
+	if !IsValidated(attr) {
+		return attr, QualityGood, true
+	}
+	rawValue, err := strconv.ParseFloat(attr.RawValue, 64)
+	if err != nil {
+		return attr, QualityGood, true
+	}
+	family := node.Attr["Family"].Value
+	goodValue, isValid, hasValue := pb.validator.Validate(node.NodeID, family, attrName, rawValue)
+	if isValid {
+		return attr, QualityGood, true
+	}
+	logrus.Warningf("Rejected reading '%s' of sensor '%s' of device '%s'", attr.RawValue, attrName, node.NodeID)
+	attr.RawValue = strconv.FormatFloat(goodValue, 'f', -1, 64)
+	if attr.Decimals >= 0 {
+		attr.Value = eds.FormatValue(goodValue, attr.Decimals)
+	} else {
+		attr.Value = attr.RawValue
+	}
+	return attr, QualityBad, hasValue
+}
@@ -0,0 +1,211 @@
+// Package internal validates the service configuration
+package internal
+
+import (
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wostzone/owserver/internal/configcheck"
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/filters"
+	"github.com/wostzone/owserver/internal/mqttfactory"
+	"github.com/wostzone/owserver/internal/stats"
+	"github.com/wostzone/owserver/internal/validation"
+)
+
+// Range of plausible altitudes in meters
+const (
+	MinAltitude = -500
+	MaxAltitude = 9000
+)
+
+// checkIDPart adds a problem if the value can't be used as part of a Thing ID
+func checkIDPart(problems *configcheck.Problems, path string, value string) {
+	if strings.ContainsAny(value, ": /\t") {
+		problems.Add(path, "'%s' must not contain ':', '/' or spaces as it is part of the Thing ID", value)
+	}
+}
+
+// checkInterval adds a problem if an interval or size is negative
+func checkInterval(problems *configcheck.Problems, path string, value int, defaultValue int) {
+	if value < 0 {
+		problems.Add(path, "must not be negative, got %d. Leave it out to use the default of %d",
+			value, defaultValue)
+	}
+}
+
+// checkListenAddress adds a problem if the value is not a host:port address to listen on
+func checkListenAddress(problems *configcheck.Problems, path string, address string) {
+	if address == "" {
+		return
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		problems.Add(path, "'%s' is not an address as host:port, eg 127.0.0.1:9110", address)
+	} else if portNr, err := strconv.Atoi(port); err != nil || portNr < 0 || portNr > 65535 {
+		problems.Add(path, "'%s' does not have a valid port number", address)
+	}
+}
+
+// checkStandalone adds the problems of the standalone broker connection settings
+func checkStandalone(problems *configcheck.Problems, standalone mqttfactory.Config) {
+	if standalone.BrokerURL == "" {
+		if standalone != (mqttfactory.Config{}) {
+			problems.Add("standalone.brokerURL", "must be set to use the standalone settings")
+		}
+		return
+	}
+	_, _, useTLS, err := mqttfactory.ParseBrokerURL(standalone.BrokerURL)
+	if err != nil {
+		problems.Add("standalone.brokerURL", "%s", err)
+		return
+	}
+	if (standalone.ClientCertFile == "") != (standalone.ClientKeyFile == "") {
+		problems.Add("standalone.clientKeyFile", "clientCertFile and clientKeyFile must be set together")
+	}
+	if !useTLS && (standalone.CACertFile != "" || standalone.ClientCertFile != "") {
+		problems.Add("standalone.brokerURL", "'%s' does not use TLS, so the certificates are not used. Use tls://",
+			standalone.BrokerURL)
+	}
+	if standalone.Password != "" && standalone.Username == "" {
+		problems.Add("standalone.username", "must be set when a password is set")
+	}
+	for path, filename := range map[string]string{
+		"standalone.caCertFile":     standalone.CACertFile,
+		"standalone.clientCertFile": standalone.ClientCertFile,
+		"standalone.clientKeyFile":  standalone.ClientKeyFile,
+	} {
+		if filename == "" {
+			continue
+		}
+		if _, err := os.Stat(filename); err != nil {
+			problems.Add(path, "file '%s' can't be read: %s", filename, err)
+		}
+	}
+}
+
+// ValidateConfig checks the service configuration and returns all problems at once
+// Settings that are not set use their default and are valid.
+func ValidateConfig(cfg OWServerPBConfig) configcheck.Problems {
+	problems := configcheck.Problems{}
+	defaults := OWServerPBConfig{}
+	SetConfigDefaults(&defaults)
+
+	checkIDPart(&problems, "clientID", cfg.ClientID)
+	checkIDPart(&problems, "zone", cfg.Zone)
+	if cfg.LegacyThingIDsUntil != "" {
+		if _, err := time.Parse("2006-01-02", cfg.LegacyThingIDsUntil); err != nil {
+			problems.Add("legacyThingIDsUntil", "'%s' is not a date as YYYY-MM-DD", cfg.LegacyThingIDsUntil)
+		}
+	}
+
+	if err := validateGatewayAddress(cfg.EdsAddress); err != nil {
+		problems.Add("owserverAddress", "%s", err)
+	} else if strings.HasPrefix(cfg.EdsAddress, "file://") {
+		filename := cfg.EdsAddress[len("file://"):]
+		if _, err := os.Stat(filename); err != nil {
+			problems.Add("owserverAddress", "simulation file '%s' can't be read: %s", filename, err)
+		}
+	}
+	if cfg.Password != "" && cfg.LoginName == "" {
+		problems.Add("loginName", "must be set when a password is set")
+	}
+
+	checkInterval(&problems, "tdInterval", cfg.TDInterval, defaults.TDInterval)
+	checkInterval(&problems, "valueInterval", cfg.ValueInterval, defaults.ValueInterval)
+	checkInterval(&problems, "metricsInterval", cfg.MetricsInterval, defaults.MetricsInterval)
+	checkInterval(&problems, "readyIntervals", cfg.ReadyIntervals, defaults.ReadyIntervals)
+	checkInterval(&problems, "staleNodeExpiry", cfg.StaleNodeExpiry, defaults.StaleNodeExpiry)
+	checkInterval(&problems, "historySize", cfg.HistorySize, defaults.HistorySize)
+	checkInterval(&problems, "historyDuration", cfg.HistoryDuration, defaults.HistoryDuration)
+	withDefaults := cfg
+	SetConfigDefaults(&withDefaults)
+	if withDefaults.TDInterval > 0 && withDefaults.TDInterval < withDefaults.ValueInterval {
+		problems.Add("tdInterval", "%d seconds is shorter than the valueInterval of %d seconds",
+			withDefaults.TDInterval, withDefaults.ValueInterval)
+	}
+
+	checkListenAddress(&problems, "prometheusAddress", cfg.PrometheusAddress)
+	checkListenAddress(&problems, "healthAddress", cfg.HealthAddress)
+
+	for i, windowName := range cfg.StatisticsWindows {
+		if _, err := stats.ParseWindow(windowName); err != nil {
+			problems.Add("statisticsWindows["+strconv.Itoa(i)+"]", "%s. Use 'today' or a duration such as '1h'", err)
+		}
+	}
+	if cfg.Timezone != "" {
+		if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+			problems.Add("timezone", "'%s' is not a known timezone, eg 'Europe/Amsterdam'", cfg.Timezone)
+		}
+	}
+	for romID, deviceCounters := range cfg.Counters {
+		for counterName, counterConfig := range deviceCounters {
+			if counterConfig.PulsesPerUnit < 0 {
+				problems.Add("counters."+romID+"."+counterName+".pulsesPerUnit", "must not be negative")
+			}
+		}
+	}
+	if cfg.Altitude < MinAltitude || cfg.Altitude > MaxAltitude {
+		problems.Add("altitude", "%g is not a plausible altitude in meters", cfg.Altitude)
+	}
+	for romID, deviceCalibrations := range cfg.Calibration {
+		for propName, cal := range deviceCalibrations {
+			if err := cal.Validate(); err != nil {
+				problems.Add("calibration."+romID+"."+propName, "%s", err)
+			}
+		}
+	}
+	for groupName, group := range map[string]map[string]map[string]validation.Rule{
+		"validation.families": cfg.Validation.Families,
+		"validation.devices":  cfg.Validation.Devices,
+	} {
+		for id, rules := range group {
+			for propName, rule := range rules {
+				if rule.Min > rule.Max {
+					problems.Add(groupName+"."+id+"."+propName, "min %g is larger than max %g", rule.Min, rule.Max)
+				}
+			}
+		}
+	}
+	for propName, filterConfig := range cfg.Filters.Sensors {
+		if _, err := filters.NewFilter(filterConfig); err != nil {
+			problems.Add("filters.sensors."+propName, "%s", err)
+		}
+	}
+	for romID, deviceFilters := range cfg.Filters.Devices {
+		for propName, filterConfig := range deviceFilters {
+			if _, err := filters.NewFilter(filterConfig); err != nil {
+				problems.Add("filters.devices."+romID+"."+propName, "%s", err)
+			}
+		}
+	}
+	for propName, deadband := range cfg.Deadbands {
+		if deadband < 0 {
+			problems.Add("deadbands."+propName, "must not be negative")
+		}
+	}
+	if cfg.LogLevel != "" {
+		if _, err := ParseLogLevel(cfg.LogLevel); err != nil {
+			problems.Add("logLevel", "%s", err)
+		}
+	}
+	for romID, md := range cfg.Devices {
+		checkIDPart(&problems, "devices."+romID+".logicalID", md.LogicalID)
+	}
+	checkStandalone(&problems, cfg.Standalone)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return problems
+}
+
+// ProbeGateway reads the gateway of the configuration to check that it can be reached
+// The gateway is discovered if no address is configured.
+// This returns the number of 1-wire nodes, including the gateway itself.
+func ProbeGateway(cfg OWServerPBConfig) (nodeCount int, err error) {
+	edsAPI := eds.NewEdsAPI(cfg.EdsAddress, cfg.LoginName, cfg.Password)
+	nodes, err := edsAPI.PollNodes()
+	return len(nodes), err
+}
@@ -0,0 +1,205 @@
+// Package calibration with per-device calibration of sensor values
+package calibration
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Calibration of a sensor
+// The two-point calibration, if set, maps the raw low and high readings to the reference
+// low and high values. The gain and offset are applied after the two-point calibration.
+type Calibration struct {
+	// Offset added to the sensor value
+	Offset float64 `yaml:"offset,omitempty" json:"offset"`
+	// Gain the sensor value is multiplied with. 0 is treated as 1.
+	Gain float64 `yaml:"gain,omitempty" json:"gain"`
+	// RawLow and RawHigh are the sensor readings at the low and high reference points
+	RawLow  float64 `yaml:"rawLow,omitempty" json:"rawLow"`
+	RawHigh float64 `yaml:"rawHigh,omitempty" json:"rawHigh"`
+	// RefLow and RefHigh are the true values at the low and high reference points
+	RefLow  float64 `yaml:"refLow,omitempty" json:"refLow"`
+	RefHigh float64 `yaml:"refHigh,omitempty" json:"refHigh"`
+}
+
+// Apply the calibration to a sensor value
+func (cal Calibration) Apply(value float64) float64 {
+	if cal.RawHigh != cal.RawLow {
+		value = cal.RefLow + (value-cal.RawLow)*(cal.RefHigh-cal.RefLow)/(cal.RawHigh-cal.RawLow)
+	}
+	gain := cal.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	return value*gain + cal.Offset
+}
+
+// IsZero returns true if the calibration does not change the sensor value
+func (cal Calibration) IsZero() bool {
+	return cal.Offset == 0 && (cal.Gain == 0 || cal.Gain == 1) && cal.RawHigh == cal.RawLow
+}
+
+// Validate the calibration
+func (cal Calibration) Validate() error {
+	if cal.Gain < 0 {
+		return errors.New("calibration gain must not be negative")
+	}
+	if cal.RawHigh == cal.RawLow && cal.RefHigh != cal.RefLow {
+		return errors.New("two-point calibration requires different raw low and high values")
+	}
+	return nil
+}
+
+// CalibrationStore holds the calibration of sensors by ROM ID and property name.
+// Calibrations changed at runtime are persisted and override the configured calibrations.
+// Only the runtime overrides are persisted, so later changes of the configured calibrations
+// apply to the sensors that were not changed at runtime.
+type CalibrationStore struct {
+	// file to persist calibrations changed at runtime. "" to not persist.
+	filename string
+	// configured calibrations by ROM ID and property name
+	configured map[string]map[string]Calibration
+	// calibrations changed at runtime by ROM ID and property name
+	overrides map[string]map[string]Calibration
+	mu        sync.RWMutex
+}
+
+// setCalibration sets the calibration of a sensor in a calibration map
+func setCalibration(calibrations map[string]map[string]Calibration, romID string, propName string, cal Calibration) {
+	deviceCal, found := calibrations[romID]
+	if !found {
+		deviceCal = make(map[string]Calibration)
+		calibrations[romID] = deviceCal
+	}
+	deviceCal[propName] = cal
+}
+
+// Get returns the calibration of a device sensor
+// The calibration changed at runtime overrides the configured calibration. This returns the
+// zero calibration if the sensor is not calibrated.
+func (cs *CalibrationStore) Get(romID string, propName string) Calibration {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if cal, found := cs.overrides[romID][propName]; found {
+		return cal
+	}
+	return cs.configured[romID][propName]
+}
+
+// Set the calibration of a device sensor, overriding its configured calibration
+// Use Save to persist the change.
+func (cs *CalibrationStore) Set(romID string, propName string, cal Calibration) error {
+	err := cal.Validate()
+	if err != nil {
+		return err
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	setCalibration(cs.overrides, romID, propName, cal)
+	return nil
+}
+
+// Move the calibrations of a replaced device to its replacement
+// The configured and runtime calibrations of the old device become runtime calibrations of the
+// new device. This returns false if the old device has no calibrations.
+func (cs *CalibrationStore) Move(oldRomID string, newRomID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	configuredCal, hasConfigured := cs.configured[oldRomID]
+	overrideCal, hasOverrides := cs.overrides[oldRomID]
+	if !hasConfigured && !hasOverrides {
+		return false
+	}
+	for propName, cal := range configuredCal {
+		setCalibration(cs.overrides, newRomID, propName, cal)
+	}
+	for propName, cal := range overrideCal {
+		setCalibration(cs.overrides, newRomID, propName, cal)
+	}
+	delete(cs.overrides, oldRomID)
+	return true
+}
+
+// Load the persisted calibrations, if persistence is enabled.
+// Loaded calibrations override the configured calibrations of the same sensor. Loaded
+// calibrations that equal the configured calibration are dropped, so that files saved by
+// previous versions, which included the configured calibrations, don't hide later changes of
+// the configuration. A missing file is not an error.
+func (cs *CalibrationStore) Load() error {
+	if cs.filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(cs.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		logrus.Errorf("Unable to read calibrations from '%s': %s", cs.filename, err)
+		return err
+	}
+	saved := make(map[string]map[string]Calibration)
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		logrus.Errorf("Unable to parse calibrations file '%s': %s", cs.filename, err)
+		return err
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.overrides = make(map[string]map[string]Calibration)
+	for romID, deviceCal := range saved {
+		for propName, cal := range deviceCal {
+			configuredCal, isConfigured := cs.configured[romID][propName]
+			if cal.Validate() != nil || (isConfigured && configuredCal == cal) {
+				continue
+			}
+			setCalibration(cs.overrides, romID, propName, cal)
+		}
+	}
+	return nil
+}
+
+// Save the calibrations changed at runtime to file, if persistence is enabled.
+func (cs *CalibrationStore) Save() error {
+	if cs.filename == "" {
+		return nil
+	}
+	cs.mu.RLock()
+	data, _ := json.MarshalIndent(cs.overrides, "", "  ")
+	cs.mu.RUnlock()
+
+	tmpName := cs.filename + ".tmp"
+	err := ioutil.WriteFile(tmpName, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpName, cs.filename)
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save calibrations to '%s': %s", cs.filename, err)
+	}
+	return err
+}
+
+// NewCalibrationStore creates a store with sensor calibrations
+//  calibrations with the configured calibrations by ROM ID and property name. nil for none.
+//  filename is the file to persist calibrations in, "" to not persist
+func NewCalibrationStore(calibrations map[string]map[string]Calibration, filename string) *CalibrationStore {
+	cs := &CalibrationStore{
+		filename:   filename,
+		configured: make(map[string]map[string]Calibration),
+		overrides:  make(map[string]map[string]Calibration),
+	}
+	for romID, deviceCal := range calibrations {
+		for propName, cal := range deviceCal {
+			err := cal.Validate()
+			if err != nil {
+				logrus.Errorf("Ignoring calibration of '%s' of device '%s': %s", propName, romID, err)
+				continue
+			}
+			setCalibration(cs.configured, romID, propName, cal)
+		}
+	}
+	return cs
+}
@@ -0,0 +1,109 @@
+package calibration_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/calibration"
+)
+
+const testDevice = "2A000003BB170B28"
+const testProp = "temperature"
+
+func TestApplyOffsetGain(t *testing.T) {
+	cal := calibration.Calibration{Offset: -0.5}
+	assert.Equal(t, 20.0, cal.Apply(20.5))
+	assert.False(t, cal.IsZero())
+
+	cal = calibration.Calibration{Gain: 2, Offset: 1}
+	assert.Equal(t, 21.0, cal.Apply(10))
+
+	assert.True(t, calibration.Calibration{}.IsZero())
+	assert.Equal(t, 10.0, calibration.Calibration{}.Apply(10))
+}
+
+func TestApplyTwoPoint(t *testing.T) {
+	// sensor reads 0.5 in ice water and 99.0 in boiling water
+	cal := calibration.Calibration{RawLow: 0.5, RawHigh: 99.0, RefLow: 0, RefHigh: 100}
+	assert.InDelta(t, 0.0, cal.Apply(0.5), 0.0001)
+	assert.InDelta(t, 100.0, cal.Apply(99.0), 0.0001)
+	assert.InDelta(t, 50.0, cal.Apply(49.75), 0.0001)
+}
+
+func TestValidate(t *testing.T) {
+	cs := calibration.NewCalibrationStore(nil, "")
+	err := cs.Set(testDevice, testProp, calibration.Calibration{Gain: -1})
+	assert.Error(t, err)
+	err = cs.Set(testDevice, testProp, calibration.Calibration{RawLow: 1, RawHigh: 1, RefHigh: 10})
+	assert.Error(t, err)
+	assert.True(t, cs.Get(testDevice, testProp).IsZero())
+}
+
+func TestMove(t *testing.T) {
+	cs := calibration.NewCalibrationStore(nil, "")
+	_ = cs.Set(testDevice, testProp, calibration.Calibration{Offset: 0.2})
+	assert.True(t, cs.Move(testDevice, "newDevice"))
+	assert.Equal(t, 0.2, cs.Get("newDevice", testProp).Offset)
+	assert.True(t, cs.Get(testDevice, testProp).IsZero())
+	assert.False(t, cs.Move("unknown", "newDevice"))
+}
+
+func TestConfigAndPersist(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-calibration-test.json")
+	defer os.Remove(filename)
+
+	config := map[string]map[string]calibration.Calibration{
+		testDevice: {testProp: {Offset: -0.3}},
+	}
+	cs := calibration.NewCalibrationStore(config, filename)
+	assert.Equal(t, -0.3, cs.Get(testDevice, testProp).Offset)
+
+	err := cs.Set(testDevice, testProp, calibration.Calibration{Offset: -0.6})
+	require.NoError(t, err)
+	err = cs.Save()
+	require.NoError(t, err)
+
+	// persisted calibration overrides the configuration
+	cs2 := calibration.NewCalibrationStore(config, filename)
+	err = cs2.Load()
+	require.NoError(t, err)
+	assert.Equal(t, -0.6, cs2.Get(testDevice, testProp).Offset)
+}
+
+func TestConfigChangeAfterSave(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-calibration-test2.json")
+	defer os.Remove(filename)
+	const otherProp = "humidity"
+
+	config := map[string]map[string]calibration.Calibration{
+		testDevice: {testProp: {Offset: -0.3}, otherProp: {Offset: 1.0}},
+	}
+	cs := calibration.NewCalibrationStore(config, filename)
+	err := cs.Set(testDevice, testProp, calibration.Calibration{Offset: -0.6})
+	require.NoError(t, err)
+	err = cs.Save()
+	require.NoError(t, err)
+
+	// a later change of the configuration applies to the sensor that wasn't overridden
+	newConfig := map[string]map[string]calibration.Calibration{
+		testDevice: {testProp: {Offset: -0.4}, otherProp: {Offset: 2.0}},
+	}
+	cs2 := calibration.NewCalibrationStore(newConfig, filename)
+	err = cs2.Load()
+	require.NoError(t, err)
+	assert.Equal(t, -0.6, cs2.Get(testDevice, testProp).Offset)
+	assert.Equal(t, 2.0, cs2.Get(testDevice, otherProp).Offset)
+}
+
+func TestMoveConfigured(t *testing.T) {
+	config := map[string]map[string]calibration.Calibration{
+		testDevice: {testProp: {Offset: -0.3}},
+	}
+	cs := calibration.NewCalibrationStore(config, "")
+	assert.True(t, cs.Move(testDevice, "newDevice"))
+	assert.Equal(t, -0.3, cs.Get("newDevice", testProp).Offset)
+}
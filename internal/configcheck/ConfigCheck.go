@@ -0,0 +1,135 @@
+// Package configcheck with helpers to report all problems of a configuration at once
+package configcheck
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem of a configuration setting
+type Problem struct {
+	// Path of the setting, eg "filters.sensors.humidity.type"
+	Path string
+	// Message describing the problem and how to fix it
+	Message string
+}
+
+// String returns the problem as 'path: message'
+func (p Problem) String() string {
+	if p.Path == "" {
+		return p.Message
+	}
+	return p.Path + ": " + p.Message
+}
+
+// Problems of a configuration. This implements the error interface.
+type Problems []Problem
+
+// Add a problem of a setting
+//  path of the setting
+//  format and args of the problem message
+func (problems *Problems) Add(path string, format string, args ...interface{}) {
+	*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Error returns the problems, one per line
+func (problems Problems) Error() string {
+	lines := make([]string, 0, len(problems))
+	for _, problem := range problems {
+		lines = append(lines, problem.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns the problems as error, or nil if there are no problems
+func (problems Problems) Err() error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// JoinPath returns the path of a child setting
+func JoinPath(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// FindUnknownKeys returns a problem for each key in the YAML document that doesn't match a
+// field of the target type, for example a misspelled setting.
+// Fields are matched by the name in their yaml tag.
+//  data is the YAML document
+//  target is an instance of the struct the document is decoded into
+// This returns an error if the document is not valid YAML.
+func FindUnknownKeys(data []byte, target interface{}) (Problems, error) {
+	var root yaml.Node
+	problems := Problems{}
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		return problems, err
+	}
+	findUnknownKeys(&root, reflect.TypeOf(target), "", &problems)
+	return problems, nil
+}
+
+// findUnknownKeys walks the YAML node and its children alongside the type it decodes into
+func findUnknownKeys(node *yaml.Node, t reflect.Type, path string, problems *Problems) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			findUnknownKeys(child, t, path, problems)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			value := node.Content[i+1]
+			keyPath := JoinPath(path, key)
+			switch t.Kind() {
+			case reflect.Struct:
+				field, found := fieldByYamlName(t, key)
+				if !found {
+					problems.Add(keyPath, "unknown setting on line %d", node.Content[i].Line)
+					continue
+				}
+				findUnknownKeys(value, field.Type, keyPath, problems)
+			case reflect.Map:
+				findUnknownKeys(value, t.Elem(), keyPath, problems)
+			}
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, child := range node.Content {
+				findUnknownKeys(child, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	}
+}
+
+// fieldByYamlName returns the struct field that is decoded from the YAML key
+// Fields without yaml tag use the lower case field name, like the yaml decoder.
+func fieldByYamlName(t reflect.Type, key string) (field reflect.StructField, found bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field = t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" {
+			continue
+		} else if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field, true
+		}
+	}
+	return field, false
+}
@@ -0,0 +1,63 @@
+package configcheck_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/configcheck"
+)
+
+type testFilter struct {
+	Type string `yaml:"type"`
+	Size int    `yaml:"size,omitempty"`
+}
+
+type testConfig struct {
+	Address  string                           `yaml:"address"`
+	Interval int                              `yaml:"interval,omitempty"`
+	Windows  []string                         `yaml:"windows,omitempty"`
+	Filters  map[string]testFilter            `yaml:"filters,omitempty"`
+	Devices  map[string]map[string]testFilter `yaml:"devices,omitempty"`
+	Untagged bool
+}
+
+func TestFindUnknownKeys(t *testing.T) {
+	data := []byte(`
+address: "localhost"
+intervall: 30
+untagged: true
+windows: ["1h", "today"]
+filters:
+  humidity:
+    type: median
+    sise: 3
+devices:
+  "5B000003BB170B28":
+    temperature:
+      typ: median
+`)
+	problems, err := configcheck.FindUnknownKeys(data, testConfig{})
+	require.NoError(t, err)
+	require.Len(t, problems, 3)
+	assert.Equal(t, "intervall", problems[0].Path)
+	assert.Equal(t, "filters.humidity.sise", problems[1].Path)
+	assert.Equal(t, "devices.5B000003BB170B28.temperature.typ", problems[2].Path)
+	assert.Equal(t, "intervall: unknown setting on line 3", problems[0].String())
+
+	_, err = configcheck.FindUnknownKeys([]byte("address: [unclosed"), testConfig{})
+	assert.Error(t, err)
+}
+
+func TestProblems(t *testing.T) {
+	problems := configcheck.Problems{}
+	assert.NoError(t, problems.Err())
+
+	problems.Add("valueInterval", "must not be negative, got %d", -1)
+	problems.Add("", "no gateway")
+	assert.Error(t, problems.Err())
+	assert.Equal(t, "valueInterval: must not be negative, got -1\nno gateway", problems.Error())
+	assert.Equal(t, "filters.humidity", configcheck.JoinPath("filters", "humidity"))
+	assert.Equal(t, "filters", configcheck.JoinPath("", "filters"))
+}
@@ -0,0 +1,92 @@
+// Package configfile updates settings in a yaml configuration file
+package configfile
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateConfigFile sets top level settings in a yaml configuration file.
+// Existing settings are replaced and new settings are appended. Other settings and comments
+// are retained. A missing file is created.
+//  filename is the yaml file to update
+//  settings holds the new values by setting name
+func UpdateConfigFile(filename string, settings map[string]interface{}) error {
+	doc := yaml.Node{Kind: yaml.DocumentNode}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Errorf("Unable to read config file '%s': %s", filename, err)
+		return err
+	}
+	if len(data) > 0 {
+		err = yaml.Unmarshal(data, &doc)
+		if err != nil {
+			logrus.Errorf("Unable to parse config file '%s': %s", filename, err)
+			return err
+		}
+	}
+	// a file with only comments has no content
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, HeadComment: doc.HeadComment}}
+		doc.HeadComment = ""
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		err = fmt.Errorf("config file '%s' does not contain settings", filename)
+		logrus.Error(err)
+		return err
+	}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		valueNode := &yaml.Node{}
+		err = valueNode.Encode(settings[name])
+		if err != nil {
+			logrus.Errorf("Unable to encode setting '%s': %s", name, err)
+			return err
+		}
+		setMappingValue(root, name, valueNode)
+	}
+
+	buf := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err = encoder.Encode(&doc)
+	if err == nil {
+		tmpName := filename + ".tmp"
+		err = ioutil.WriteFile(tmpName, buf.Bytes(), 0600)
+		if err == nil {
+			err = os.Rename(tmpName, filename)
+		}
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save config file '%s': %s", filename, err)
+	}
+	return err
+}
+
+// setMappingValue replaces the value of a key in a yaml mapping, or appends the key if it
+// doesn't exist.
+func setMappingValue(mapping *yaml.Node, key string, valueNode *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			// keep the comments of the existing value
+			valueNode.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = valueNode
+			return
+		}
+	}
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append(mapping.Content, keyNode, valueNode)
+}
@@ -0,0 +1,78 @@
+package configfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/wostzone/owserver/internal/configfile"
+)
+
+const testConfig = `# Onewire protocol binding service config
+
+# polling interval
+valueInterval: 60 # seconds
+
+#tdInterval: 3600
+owserverAddress: 192.168.1.101
+`
+
+func TestUpdateConfigFile(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-configfile-test.yaml")
+	defer os.Remove(filename)
+	err := ioutil.WriteFile(filename, []byte(testConfig), 0600)
+	require.NoError(t, err)
+
+	err = configfile.UpdateConfigFile(filename, map[string]interface{}{
+		"valueInterval": 30,
+		"tdInterval":    600,
+		"deadbands":     map[string]float64{"temperature": 0.1},
+	})
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	// comments are retained
+	assert.Contains(t, string(data), "# Onewire protocol binding service config")
+	assert.Contains(t, string(data), "# seconds")
+
+	settings := struct {
+		ValueInterval int                `yaml:"valueInterval"`
+		TDInterval    int                `yaml:"tdInterval"`
+		EdsAddress    string             `yaml:"owserverAddress"`
+		Deadbands     map[string]float64 `yaml:"deadbands"`
+	}{}
+	err = yaml.Unmarshal(data, &settings)
+	require.NoError(t, err)
+	assert.Equal(t, 30, settings.ValueInterval)
+	assert.Equal(t, 600, settings.TDInterval)
+	assert.Equal(t, "192.168.1.101", settings.EdsAddress)
+	assert.Equal(t, 0.1, settings.Deadbands["temperature"])
+}
+
+func TestUpdateMissingFile(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-configfile-missing.yaml")
+	_ = os.Remove(filename)
+	defer os.Remove(filename)
+
+	err := configfile.UpdateConfigFile(filename, map[string]interface{}{"logLevel": "debug"})
+	require.NoError(t, err)
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "logLevel: debug\n", string(data))
+}
+
+func TestUpdateInvalidFile(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-configfile-invalid.yaml")
+	defer os.Remove(filename)
+	err := ioutil.WriteFile(filename, []byte("- not\n- settings\n"), 0600)
+	require.NoError(t, err)
+
+	err = configfile.UpdateConfigFile(filename, map[string]interface{}{"logLevel": "debug"})
+	assert.Error(t, err)
+}
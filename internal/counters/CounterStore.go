@@ -0,0 +1,182 @@
+// Package counters with tracking of pulse counter totals and rates
+package counters
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CounterWrap is the value at which the 32 bit 1-wire counters wrap around to 0
+const CounterWrap = float64(1 << 32)
+
+// wrapMargin is the fraction of the counter range near the wrap value in which a decrease
+// of the counter is considered a wrap-around instead of a reset.
+const wrapMargin = 0.1
+
+// CounterState with the tracking state of a single pulse counter
+type CounterState struct {
+	// LastCount is the last raw counter value read from the device
+	LastCount float64 `json:"lastCount"`
+	// LastTime is the time the last counter value was read
+	LastTime time.Time `json:"lastTime"`
+	// Total is the total number of pulses counted, including those before counter resets
+	Total float64 `json:"total"`
+	// Resets is the number of times the device counter was reset
+	Resets int `json:"resets"`
+}
+
+// CounterStore tracks the totals of pulse counters. The totals survive wrap-around
+// of the counter, counter resets after a power loss and, when persisted, restarts
+// of the service.
+type CounterStore struct {
+	// file to persist the counter totals in. "" to not persist.
+	filename string
+	// counter state by device ID and counter name
+	counters map[string]map[string]*CounterState
+	mu       sync.RWMutex
+}
+
+// Update the counter with a new raw counter value
+// This returns the updated total number of pulses and the rate in pulses per second.
+// The rate is only valid if hasRate is true, which requires a previous counter value.
+//  deviceID is the ID of the device with the counter
+//  name is the name of the counter
+//  count is the raw counter value read from the device
+//  timestamp is the time the counter value was read
+func (cs *CounterStore) Update(deviceID string, name string, count float64, timestamp time.Time) (
+	total float64, rate float64, hasRate bool) {
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	deviceCounters, found := cs.counters[deviceID]
+	if !found {
+		deviceCounters = make(map[string]*CounterState)
+		cs.counters[deviceID] = deviceCounters
+	}
+	state, found := deviceCounters[name]
+	if !found {
+		// the first value is the starting point
+		deviceCounters[name] = &CounterState{LastCount: count, LastTime: timestamp}
+		return 0, 0, false
+	} else if state.LastTime.IsZero() {
+		// the counter was moved from a replaced device and continues from this value
+		state.LastCount = count
+		state.LastTime = timestamp
+		return state.Total, 0, false
+	}
+	delta := count - state.LastCount
+	if delta < 0 {
+		if state.LastCount > CounterWrap*(1-wrapMargin) && count < CounterWrap*wrapMargin {
+			// the counter wrapped around
+			delta = CounterWrap - state.LastCount + count
+		} else {
+			// the counter was reset, eg after a power loss, and has started again from 0
+			logrus.Warningf("Counter '%s' of device '%s' was reset from %.0f to %.0f",
+				name, deviceID, state.LastCount, count)
+			delta = count
+			state.Resets++
+		}
+	}
+	elapsed := timestamp.Sub(state.LastTime).Seconds()
+	state.Total += delta
+	state.LastCount = count
+	state.LastTime = timestamp
+	if elapsed > 0 {
+		rate = delta / elapsed
+		hasRate = true
+	}
+	return state.Total, rate, hasRate
+}
+
+// Get returns a copy of the state of a counter, or nil if the counter is unknown
+func (cs *CounterStore) Get(deviceID string, name string) *CounterState {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	state, found := cs.counters[deviceID][name]
+	if !found {
+		return nil
+	}
+	stateCopy := *state
+	return &stateCopy
+}
+
+// Move the counter totals of a replaced device to its replacement
+// The totals of the new device continue from the first counter value read from it.
+// This returns false if the old device has no counters.
+func (cs *CounterStore) Move(oldDeviceID string, newDeviceID string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	deviceCounters, found := cs.counters[oldDeviceID]
+	if !found {
+		return false
+	}
+	for _, state := range deviceCounters {
+		state.LastCount = 0
+		state.LastTime = time.Time{}
+	}
+	cs.counters[newDeviceID] = deviceCounters
+	delete(cs.counters, oldDeviceID)
+	return true
+}
+
+// Load the counter totals from file, if persistence is enabled.
+// A missing file is not an error.
+func (cs *CounterStore) Load() error {
+	if cs.filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(cs.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		logrus.Errorf("Unable to read counters from '%s': %s", cs.filename, err)
+		return err
+	}
+	counters := make(map[string]map[string]*CounterState)
+	err = json.Unmarshal(data, &counters)
+	if err != nil {
+		logrus.Errorf("Unable to parse counters file '%s': %s", cs.filename, err)
+		return err
+	}
+	cs.mu.Lock()
+	cs.counters = counters
+	cs.mu.Unlock()
+	logrus.Infof("Loaded counters of %d devices from '%s'", len(counters), cs.filename)
+	return nil
+}
+
+// Save the counter totals to file, if persistence is enabled.
+// The file is first written to a temporary file and then renamed to avoid corruption.
+func (cs *CounterStore) Save() error {
+	if cs.filename == "" {
+		return nil
+	}
+	cs.mu.RLock()
+	data, _ := json.MarshalIndent(cs.counters, "", "  ")
+	cs.mu.RUnlock()
+
+	tmpName := cs.filename + ".tmp"
+	err := ioutil.WriteFile(tmpName, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpName, cs.filename)
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save counters to '%s': %s", cs.filename, err)
+	}
+	return err
+}
+
+// NewCounterStore creates a store for tracking pulse counters
+//  filename is the file to persist the counter totals in, "" to not persist
+func NewCounterStore(filename string) *CounterStore {
+	cs := &CounterStore{
+		filename: filename,
+		counters: make(map[string]map[string]*CounterState),
+	}
+	return cs
+}
@@ -0,0 +1,88 @@
+package counters_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/counters"
+)
+
+const testDevice = "device1"
+const testCounter = "counter1"
+
+func TestCountAndRate(t *testing.T) {
+	cs := counters.NewCounterStore("")
+	now := time.Now()
+	total, _, hasRate := cs.Update(testDevice, testCounter, 1000, now)
+	assert.Equal(t, 0.0, total)
+	assert.False(t, hasRate)
+
+	total, rate, hasRate := cs.Update(testDevice, testCounter, 1100, now.Add(10*time.Second))
+	assert.Equal(t, 100.0, total)
+	assert.True(t, hasRate)
+	assert.Equal(t, 10.0, rate)
+}
+
+func TestCounterWrap(t *testing.T) {
+	cs := counters.NewCounterStore("")
+	now := time.Now()
+	cs.Update(testDevice, testCounter, counters.CounterWrap-10, now)
+	total, _, _ := cs.Update(testDevice, testCounter, 5, now.Add(time.Second))
+	assert.Equal(t, 15.0, total)
+	assert.Equal(t, 0, cs.Get(testDevice, testCounter).Resets)
+}
+
+func TestCounterReset(t *testing.T) {
+	cs := counters.NewCounterStore("")
+	now := time.Now()
+	cs.Update(testDevice, testCounter, 5000, now)
+	cs.Update(testDevice, testCounter, 5100, now.Add(time.Second))
+	// device lost power and restarted counting from 0
+	total, _, _ := cs.Update(testDevice, testCounter, 20, now.Add(2*time.Second))
+	assert.Equal(t, 120.0, total)
+	assert.Equal(t, 1, cs.Get(testDevice, testCounter).Resets)
+	assert.Nil(t, cs.Get(testDevice, "unknown"))
+}
+
+func TestMove(t *testing.T) {
+	cs := counters.NewCounterStore("")
+	now := time.Now()
+	cs.Update(testDevice, testCounter, 1000, now)
+	cs.Update(testDevice, testCounter, 1200, now.Add(time.Second))
+	moved := cs.Move(testDevice, "device2")
+	assert.True(t, moved)
+	assert.Nil(t, cs.Get(testDevice, testCounter))
+
+	// the replacement starts counting at its own value
+	total, _, hasRate := cs.Update("device2", testCounter, 50, now.Add(2*time.Second))
+	assert.Equal(t, 200.0, total)
+	assert.False(t, hasRate)
+	total, _, _ = cs.Update("device2", testCounter, 60, now.Add(3*time.Second))
+	assert.Equal(t, 210.0, total)
+	assert.Equal(t, 0, cs.Get("device2", testCounter).Resets)
+}
+
+func TestSaveLoad(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-counters-test.json")
+	defer os.Remove(filename)
+	now := time.Now()
+
+	cs := counters.NewCounterStore(filename)
+	cs.Update(testDevice, testCounter, 100, now)
+	cs.Update(testDevice, testCounter, 150, now.Add(time.Second))
+	err := cs.Save()
+	require.NoError(t, err)
+
+	// the total continues after a restart
+	cs2 := counters.NewCounterStore(filename)
+	err = cs2.Load()
+	require.NoError(t, err)
+	total, _, hasRate := cs2.Update(testDevice, testCounter, 160, now.Add(2*time.Second))
+	assert.Equal(t, 60.0, total)
+	assert.True(t, hasRate)
+}
@@ -0,0 +1,135 @@
+// Package deadband suppresses publication of insignificant sensor value changes
+package deadband
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DeadbandStore holds the deadbands by sensor property name and the last published value
+// of each sensor. A new value is only published if it differs from the last published value
+// by at least the deadband of the sensor.
+type DeadbandStore struct {
+	// deadband by sensor property name, eg temperature
+	deadbands map[string]float64
+	// last published value by ROM ID and sensor property name
+	published map[string]map[string]string
+	mu        sync.RWMutex
+}
+
+// Apply the deadband of a sensor to a new value
+// This returns the value to publish, which is the last published value if the change is
+// within the deadband. Non-numeric values and sensors without deadband are passed through.
+//  romID is the device ID
+//  propName is the sensor property name
+//  value is the new sensor value
+func (store *DeadbandStore) Apply(romID string, propName string, value string) string {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deadband := store.deadbands[propName]
+	newValue, err := strconv.ParseFloat(value, 64)
+	if deadband <= 0 || err != nil {
+		return value
+	}
+	deviceValues := store.published[romID]
+	if deviceValues == nil {
+		deviceValues = make(map[string]string)
+		store.published[romID] = deviceValues
+	}
+	lastValue, err := strconv.ParseFloat(deviceValues[propName], 64)
+	if err == nil && math.Abs(newValue-lastValue) < deadband {
+		return deviceValues[propName]
+	}
+	deviceValues[propName] = value
+	return value
+}
+
+// GetDeadbands returns a copy of the deadbands by sensor property name
+func (store *DeadbandStore) GetDeadbands() map[string]float64 {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	deadbands := make(map[string]float64, len(store.deadbands))
+	for propName, deadband := range store.deadbands {
+		deadbands[propName] = deadband
+	}
+	return deadbands
+}
+
+// SetDeadbands replaces the deadbands by sensor property name
+// The next value of each sensor is published as is.
+func (store *DeadbandStore) SetDeadbands(deadbands map[string]float64) error {
+	if err := ValidateDeadbands(deadbands); err != nil {
+		return err
+	}
+	newDeadbands := make(map[string]float64, len(deadbands))
+	for propName, deadband := range deadbands {
+		newDeadbands[propName] = deadband
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.deadbands = newDeadbands
+	store.published = make(map[string]map[string]string)
+	return nil
+}
+
+// ValidateDeadbands returns an error if a deadband is negative
+func ValidateDeadbands(deadbands map[string]float64) error {
+	for propName, deadband := range deadbands {
+		if deadband < 0 {
+			return fmt.Errorf("deadband of '%s' is negative", propName)
+		}
+	}
+	return nil
+}
+
+// FormatDeadbands returns the deadbands as text, sorted by name, eg "humidity=1,temperature=0.1"
+func FormatDeadbands(deadbands map[string]float64) string {
+	parts := make([]string, 0, len(deadbands))
+	for propName, deadband := range deadbands {
+		parts = append(parts, propName+"="+strconv.FormatFloat(deadband, 'f', -1, 64))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// ParseDeadbands parses deadbands from text as produced by FormatDeadbands
+// An empty text has no deadbands.
+func ParseDeadbands(text string) (map[string]float64, error) {
+	deadbands := make(map[string]float64)
+	if strings.TrimSpace(text) == "" {
+		return deadbands, nil
+	}
+	for _, part := range strings.Split(text, ",") {
+		nameValue := strings.SplitN(part, "=", 2)
+		propName := strings.TrimSpace(nameValue[0])
+		if len(nameValue) != 2 || propName == "" {
+			return nil, fmt.Errorf("deadband '%s' is not formatted as name=value", part)
+		}
+		deadband, err := strconv.ParseFloat(strings.TrimSpace(nameValue[1]), 64)
+		if err != nil || deadband < 0 {
+			return nil, fmt.Errorf("deadband of '%s' is not a positive number", propName)
+		}
+		deadbands[propName] = deadband
+	}
+	return deadbands, nil
+}
+
+// NewDeadbandStore creates a store with the deadbands of sensors
+// Invalid deadbands are ignored.
+//  deadbands by sensor property name, eg temperature
+func NewDeadbandStore(deadbands map[string]float64) *DeadbandStore {
+	store := &DeadbandStore{
+		deadbands: make(map[string]float64),
+		published: make(map[string]map[string]string),
+	}
+	for propName, deadband := range deadbands {
+		if deadband > 0 {
+			store.deadbands[propName] = deadband
+		}
+	}
+	return store
+}
@@ -0,0 +1,65 @@
+package deadband_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/deadband"
+)
+
+const testDevice = "2A000003BB170B28"
+
+func TestApply(t *testing.T) {
+	store := deadband.NewDeadbandStore(map[string]float64{"temperature": 0.5})
+
+	assert.Equal(t, "20.0", store.Apply(testDevice, "temperature", "20.0"))
+	// within the deadband the last published value is held
+	assert.Equal(t, "20.0", store.Apply(testDevice, "temperature", "20.4"))
+	assert.Equal(t, "20.0", store.Apply(testDevice, "temperature", "19.6"))
+	// slow drift is published once it exceeds the deadband
+	assert.Equal(t, "20.5", store.Apply(testDevice, "temperature", "20.5"))
+	// other devices have their own last value
+	assert.Equal(t, "20.2", store.Apply("other", "temperature", "20.2"))
+
+	// sensors without deadband and non-numeric values are passed through
+	assert.Equal(t, "55.1", store.Apply(testDevice, "humidity", "55.1"))
+	assert.Equal(t, "on", store.Apply(testDevice, "temperature", "on"))
+}
+
+func TestSetDeadbands(t *testing.T) {
+	store := deadband.NewDeadbandStore(nil)
+	assert.Empty(t, store.GetDeadbands())
+
+	err := store.SetDeadbands(map[string]float64{"humidity": 1})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"humidity": 1}, store.GetDeadbands())
+	assert.Equal(t, "50", store.Apply(testDevice, "humidity", "50"))
+	assert.Equal(t, "50", store.Apply(testDevice, "humidity", "50.5"))
+
+	err = store.SetDeadbands(map[string]float64{"humidity": -1})
+	assert.Error(t, err)
+	assert.Equal(t, map[string]float64{"humidity": 1}, store.GetDeadbands())
+}
+
+func TestFormatParse(t *testing.T) {
+	deadbands := map[string]float64{"temperature": 0.1, "humidity": 1}
+	text := deadband.FormatDeadbands(deadbands)
+	assert.Equal(t, "humidity=1,temperature=0.1", text)
+
+	parsed, err := deadband.ParseDeadbands(text)
+	require.NoError(t, err)
+	assert.Equal(t, deadbands, parsed)
+
+	parsed, err = deadband.ParseDeadbands(" ")
+	require.NoError(t, err)
+	assert.Empty(t, parsed)
+
+	_, err = deadband.ParseDeadbands("temperature")
+	assert.Error(t, err)
+	_, err = deadband.ParseDeadbands("temperature=-1")
+	assert.Error(t, err)
+	_, err = deadband.ParseDeadbands("temperature=abc")
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+// Package derived with values that are computed from sensor values
+// All temperatures are in degrees Celsius, relative humidity in percent and pressure in millibar.
+package derived
+
+import "math"
+
+// Magnus formula coefficients for water vapor over water, valid for -45C to 60C
+const (
+	magnusA = 17.62
+	magnusB = 243.12
+)
+
+// AbsoluteHumidity returns the absolute humidity in grams of water vapor per cubic meter of air
+//  temperature in degrees Celsius
+//  humidity is the relative humidity in percent
+func AbsoluteHumidity(temperature float64, humidity float64) float64 {
+	saturation := 6.112 * math.Exp(magnusA*temperature/(magnusB+temperature))
+	return saturation * humidity * 2.1674 / (273.15 + temperature)
+}
+
+// DewPoint returns the dew point temperature in degrees Celsius using the Magnus formula
+//  temperature in degrees Celsius
+//  humidity is the relative humidity in percent
+func DewPoint(temperature float64, humidity float64) float64 {
+	if humidity <= 0 {
+		humidity = 0.01
+	}
+	gamma := math.Log(humidity/100) + magnusA*temperature/(magnusB+temperature)
+	return magnusB * gamma / (magnusA - gamma)
+}
+
+// HeatIndex returns the apparent temperature in degrees Celsius as defined by the US National
+// Weather Service, using the Rothfusz regression with its adjustments.
+//  temperature in degrees Celsius
+//  humidity is the relative humidity in percent
+func HeatIndex(temperature float64, humidity float64) float64 {
+	t := CelsiusToFahrenheit(temperature)
+	rh := humidity
+	// the simple formula is used when the heat index is below 80F
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (hi+t)/2 >= 80 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh -
+			0.00683783*t*t - 0.05481717*rh*rh + 0.00122874*t*t*rh +
+			0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		if rh < 13 && t >= 80 && t <= 112 {
+			hi -= ((13 - rh) / 4) * math.Sqrt((17-math.Abs(t-95))/17)
+		} else if rh > 85 && t >= 80 && t <= 87 {
+			hi += ((rh - 85) / 10) * ((87 - t) / 5)
+		}
+	}
+	return FahrenheitToCelsius(hi)
+}
+
+// Humidex returns the Canadian humidex in degrees Celsius
+//  temperature in degrees Celsius
+//  dewPoint temperature in degrees Celsius
+func Humidex(temperature float64, dewPoint float64) float64 {
+	vaporPressure := 6.11 * math.Exp(5417.7530*(1/273.16-1/(273.15+dewPoint)))
+	return temperature + 0.5555*(vaporPressure-10)
+}
+
+// SeaLevelPressure returns the barometric pressure reduced to sea level in millibar
+// using the hypsometric formula.
+//  pressure is the measured pressure in millibar
+//  altitude of the sensor in meters above sea level
+//  temperature in degrees Celsius
+func SeaLevelPressure(pressure float64, altitude float64, temperature float64) float64 {
+	return pressure * math.Pow(1-(0.0065*altitude)/(temperature+0.0065*altitude+273.15), -5.257)
+}
+
+// CelsiusToFahrenheit converts a temperature in Celsius to Fahrenheit
+func CelsiusToFahrenheit(temperature float64) float64 {
+	return temperature*9/5 + 32
+}
+
+// FahrenheitToCelsius converts a temperature in Fahrenheit to Celsius
+func FahrenheitToCelsius(temperature float64) float64 {
+	return (temperature - 32) * 5 / 9
+}
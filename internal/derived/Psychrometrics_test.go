@@ -0,0 +1,49 @@
+package derived_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/derived"
+)
+
+// values reported by the EDS0068 in the simulation file
+const testTemperature = 15.9375
+const testHumidity = 42.3125
+
+func TestDewPoint(t *testing.T) {
+	// the EDS0068 reports 3.125C
+	dp := derived.DewPoint(testTemperature, testHumidity)
+	assert.InDelta(t, 3.1, dp, 0.2)
+	// at 100% humidity the dew point equals the temperature
+	assert.InDelta(t, 20.0, derived.DewPoint(20, 100), 0.01)
+}
+
+func TestAbsoluteHumidity(t *testing.T) {
+	// 20C at 50% contains approximately 8.6 g/m3
+	assert.InDelta(t, 8.6, derived.AbsoluteHumidity(20, 50), 0.1)
+}
+
+func TestHumidex(t *testing.T) {
+	// 30C with a dew point of 15C gives a humidex of approximately 34
+	assert.InDelta(t, 34.0, derived.Humidex(30, 15), 0.5)
+}
+
+func TestHeatIndex(t *testing.T) {
+	// below 80F the heat index is close to the temperature
+	assert.InDelta(t, testTemperature, derived.HeatIndex(testTemperature, testHumidity), 1.5)
+	// 32C at 70% humidity gives a heat index of approximately 41C
+	assert.InDelta(t, 41.0, derived.HeatIndex(32, 70), 1)
+}
+
+func TestSeaLevelPressure(t *testing.T) {
+	assert.Equal(t, 1000.0, derived.SeaLevelPressure(1000, 0, 15))
+	// pressure drops approximately 12 mbar per 100m near sea level
+	assert.InDelta(t, 1012.0, derived.SeaLevelPressure(1000, 100, 15), 1)
+}
+
+func TestTemperatureConversion(t *testing.T) {
+	assert.Equal(t, 212.0, derived.CelsiusToFahrenheit(100))
+	assert.Equal(t, 0.0, derived.FahrenheitToCelsius(32))
+}
@@ -0,0 +1,188 @@
+// Package dryrun writes the exposed things as JSON lines instead of publishing them
+// This is used to debug the mapping of devices to Things without a message bus.
+package dryrun
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/wostzone/wost-go/pkg/consumedthing"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+)
+
+// Types of the messages written to the output
+const (
+	// MessageTypeTD is the exposure of a TD
+	MessageTypeTD = "td"
+	// MessageTypeProperties is a change of property values
+	MessageTypeProperties = "properties"
+	// MessageTypeEvent is an emitted event
+	MessageTypeEvent = "event"
+	// MessageTypeStatus is a change of the status property of a Thing
+	MessageTypeStatus = "status"
+	// MessageTypeDestroy is the removal of an exposed thing
+	MessageTypeDestroy = "destroy"
+)
+
+// TimeFormat of the message time
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Message is a single line of the output
+type Message struct {
+	// Time the message was written
+	Time string `json:"time"`
+	// Type of the message, eg MessageTypeTD
+	Type string `json:"type"`
+	// ThingID of the Thing the message is about
+	ThingID string `json:"thingID"`
+	// DeviceID of the exposed thing
+	DeviceID string `json:"deviceID,omitempty"`
+	// Topic the message would have been published on
+	Topic string `json:"topic,omitempty"`
+	// Name of the event
+	Name string `json:"name,omitempty"`
+	// Data with the TD, property values, event value or status
+	Data interface{} `json:"data,omitempty"`
+}
+
+// DryRunFactory writes each TD exposure, property change, event and status change as a JSON
+// line instead of publishing it
+type DryRunFactory struct {
+	// encoder of the JSON lines to the output
+	encoder *json.Encoder
+	// statusProperty is the name of the property reported as status change, "" for none
+	statusProperty string
+	// last written status by Thing ID
+	lastStatus map[string]interface{}
+	// exposed things by Thing ID
+	eThings map[string]*exposedthing.ExposedThing
+	mu      sync.Mutex
+}
+
+// write a message as a JSON line
+func (factory *DryRunFactory) write(msg Message) error {
+	msg.Time = time.Now().Format(TimeFormat)
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	err := factory.encoder.Encode(msg)
+	if err != nil {
+		logrus.Errorf("Unable to write the %s of '%s': %s", msg.Type, msg.ThingID, err)
+	}
+	return err
+}
+
+// writeProperties writes the property values and, if it changed, the status
+func (factory *DryRunFactory) writeProperties(eThing *exposedthing.ExposedThing, props map[string]interface{}) error {
+	thingID := eThing.TD.ID
+	err := factory.write(Message{
+		Type:     MessageTypeProperties,
+		ThingID:  thingID,
+		DeviceID: eThing.DeviceID,
+		Topic:    strings.ReplaceAll(consumedthing.TopicEmitPropertiesChange, "{thingID}", thingID),
+		Data:     props,
+	})
+	status, found := props[factory.statusProperty]
+	if err != nil || factory.statusProperty == "" || !found {
+		return err
+	}
+	factory.mu.Lock()
+	lastStatus, hasLast := factory.lastStatus[thingID]
+	factory.lastStatus[thingID] = status
+	factory.mu.Unlock()
+	if hasLast && reflect.DeepEqual(lastStatus, status) {
+		return nil
+	}
+	return factory.write(Message{
+		Type:     MessageTypeStatus,
+		ThingID:  thingID,
+		DeviceID: eThing.DeviceID,
+		Data:     status,
+	})
+}
+
+// Connect does nothing as there is no message bus
+func (factory *DryRunFactory) Connect(address string, port int) error {
+	logrus.Infof("Dry run: not connecting to the message bus")
+	return nil
+}
+
+// Disconnect does nothing as there is no message bus
+func (factory *DryRunFactory) Disconnect() {
+}
+
+// IsConnected returns true as there is no message bus to lose
+func (factory *DryRunFactory) IsConnected() bool {
+	return true
+}
+
+// Expose creates an exposed thing and writes its TD
+// This returns the existing exposed thing and true if a Thing with the same ID is already exposed.
+//  deviceID is the internal ID of the device
+//  td is the Thing Description document of the Thing
+func (factory *DryRunFactory) Expose(deviceID string, td *thing.ThingTD) (*exposedthing.ExposedThing, bool) {
+	factory.mu.Lock()
+	eThing, found := factory.eThings[td.ID]
+	if found {
+		factory.mu.Unlock()
+		return eThing, true
+	}
+	eThing = exposedthing.CreateExposedThing(deviceID, td)
+	eThing.EmitEventHook = func(name string, data interface{}) error {
+		return factory.write(Message{
+			Type:     MessageTypeEvent,
+			ThingID:  td.ID,
+			DeviceID: deviceID,
+			Topic:    strings.ReplaceAll(consumedthing.TopicEmitEvent, "{thingID}", td.ID) + "/" + name,
+			Name:     name,
+			Data:     data,
+		})
+	}
+	eThing.EmitPropertiesChangeHook = func(props map[string]interface{}) error {
+		return factory.writeProperties(eThing, props)
+	}
+	factory.eThings[td.ID] = eThing
+	factory.mu.Unlock()
+
+	_ = factory.write(Message{
+		Type:     MessageTypeTD,
+		ThingID:  td.ID,
+		DeviceID: deviceID,
+		Topic:    strings.ReplaceAll(consumedthing.TopicThingTD, "{thingID}", td.ID),
+		Data:     td,
+	})
+	return eThing, false
+}
+
+// Destroy removes an exposed thing and writes its removal
+func (factory *DryRunFactory) Destroy(eThing *exposedthing.ExposedThing) {
+	factory.mu.Lock()
+	eThing.Destroy()
+	delete(factory.eThings, eThing.TD.ID)
+	delete(factory.lastStatus, eThing.TD.ID)
+	factory.mu.Unlock()
+
+	_ = factory.write(Message{
+		Type:     MessageTypeDestroy,
+		ThingID:  eThing.TD.ID,
+		DeviceID: eThing.DeviceID,
+	})
+}
+
+// NewDryRunFactory creates a factory that writes the exposed things as JSON lines
+//  out is the output to write to, eg os.Stdout or a file
+//  statusProperty is the name of the property to also write as status change, "" for none
+func NewDryRunFactory(out io.Writer, statusProperty string) *DryRunFactory {
+	factory := &DryRunFactory{
+		encoder:        json.NewEncoder(out),
+		statusProperty: statusProperty,
+		lastStatus:     make(map[string]interface{}),
+		eThings:        make(map[string]*exposedthing.ExposedThing),
+	}
+	return factory
+}
@@ -0,0 +1,91 @@
+package dryrun_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal/dryrun"
+)
+
+// readMessages parses the JSON lines of the output
+func readMessages(t *testing.T, buf *bytes.Buffer) []dryrun.Message {
+	messages := make([]dryrun.Message, 0)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		msg := dryrun.Message{}
+		err := json.Unmarshal(scanner.Bytes(), &msg)
+		require.NoError(t, err)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func TestExpose(t *testing.T) {
+	var buf bytes.Buffer
+	factory := dryrun.NewDryRunFactory(&buf, "status")
+	require.NoError(t, factory.Connect("", 0))
+	td := thing.CreateTD("local:owserver:device1", "Device 1", vocab.DeviceTypeSensor)
+
+	eThing, found := factory.Expose("device1", td)
+	require.NotNil(t, eThing)
+	assert.False(t, found)
+	_, found = factory.Expose("device1", td)
+	assert.True(t, found)
+
+	messages := readMessages(t, &buf)
+	require.Len(t, messages, 1)
+	assert.Equal(t, dryrun.MessageTypeTD, messages[0].Type)
+	assert.Equal(t, td.ID, messages[0].ThingID)
+	assert.Equal(t, "device1", messages[0].DeviceID)
+	assert.Equal(t, "things/local:owserver:device1/td", messages[0].Topic)
+	assert.NotEmpty(t, messages[0].Time)
+
+	factory.Destroy(eThing)
+	factory.Disconnect()
+	messages = readMessages(t, &buf)
+	require.Len(t, messages, 1)
+	assert.Equal(t, dryrun.MessageTypeDestroy, messages[0].Type)
+}
+
+func TestPropertiesAndEvents(t *testing.T) {
+	var buf bytes.Buffer
+	factory := dryrun.NewDryRunFactory(&buf, "status")
+	td := thing.CreateTD("local:owserver:device1", "Device 1", vocab.DeviceTypeSensor)
+	eThing, _ := factory.Expose("device1", td)
+	_ = readMessages(t, &buf)
+
+	err := eThing.EmitPropertiesChangeHook(map[string]interface{}{"temperature": 21.5, "status": "online"})
+	require.NoError(t, err)
+	err = eThing.EmitPropertiesChangeHook(map[string]interface{}{"temperature": 21.6, "status": "online"})
+	require.NoError(t, err)
+	err = eThing.EmitPropertiesChangeHook(map[string]interface{}{"status": "stale"})
+	require.NoError(t, err)
+	err = eThing.EmitEventHook("alarm", "on")
+	require.NoError(t, err)
+
+	messages := readMessages(t, &buf)
+	types := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		types = append(types, msg.Type)
+	}
+	// the status is only written when it changes
+	assert.Equal(t, []string{
+		dryrun.MessageTypeProperties, dryrun.MessageTypeStatus,
+		dryrun.MessageTypeProperties,
+		dryrun.MessageTypeProperties, dryrun.MessageTypeStatus,
+		dryrun.MessageTypeEvent,
+	}, types)
+	assert.Equal(t, map[string]interface{}{"temperature": 21.5, "status": "online"}, messages[0].Data)
+	assert.Equal(t, "online", messages[1].Data)
+	assert.Equal(t, "stale", messages[4].Data)
+	assert.Equal(t, "alarm", messages[5].Name)
+	assert.Equal(t, "on", messages[5].Data)
+	assert.Equal(t, "things/local:owserver:device1/event/alarm", messages[5].Topic)
+}
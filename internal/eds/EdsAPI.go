@@ -23,6 +23,7 @@ import (
 var deviceTypeMap = map[string]vocab.DeviceType{
 	"10": vocab.DeviceTypeThermometer,
 	"28": vocab.DeviceTypeThermometer,
+	"1D": vocab.DeviceTypeSensor,
 	"7E": vocab.DeviceTypeMultisensor,
 }
 
@@ -35,8 +36,6 @@ var AttrVocab = map[string]string{
 	"Version":    vocab.PropNameSoftwareVersion,
 	// Exclude/ignore the following attributes as they are chatty and not useful
 	"BarometricPressureHg": "",
-	"Counter1":             "",
-	"Counter2":             "",
 	"DateTime":             "",
 	"Looptime":             "",
 	"PollCount":            "",
@@ -64,6 +63,89 @@ var SensorTypeVocab = map[string]struct {
 	"VoltageChannel3":      {name: "VoltageChannel3", dataType: vocab.WoTDataTypeNumber, decimals: 1},
 }
 
+// CounterVocab maps OWServer pulse counter names to IoT vocabulary
+// Counters are not published as-is but are converted to totals and rates.
+var CounterVocab = map[string]string{
+	"Counter1":  "counter1", // EDS0068 and other EDS devices
+	"Counter2":  "counter2",
+	"Counter_A": "counterA", // DS2423
+	"Counter_B": "counterB",
+}
+
+// AttrInfo with the description, semantic type and constraints of an OWServer attribute
+type AttrInfo struct {
+	Description string        `json:"description,omitempty"`
+	AtType      string        `json:"@type,omitempty"`    // semantic type of sensors
+	DataType    string        `json:"dataType,omitempty"` // data type of attributes, default is string
+	Minimum     float64       `json:"minimum,omitempty"`  // Minimum and Maximum are ignored if equal
+	Maximum     float64       `json:"maximum,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// HasRange returns true if the attribute has a minimum and maximum value
+func (info AttrInfo) HasRange() bool {
+	return info.Maximum > info.Minimum
+}
+
+// SarefNamespace is the IRI of the SAREF ontology used for the semantic type of sensors
+// The TD context can't define a prefix so the semantic types are full IRIs.
+const SarefNamespace = "https://saref.etsi.org/core/"
+
+// AttrInfoVocab with the description, semantic type and constraints of OWServer attributes
+// Alarm attributes are handled by GetAttrInfo.
+var AttrInfoVocab = map[string]AttrInfo{
+	"BarometricPressureMb": {Description: "Barometric pressure", AtType: SarefNamespace + "Pressure"},
+	"Channel": {Description: "Gateway bus channel the device is connected to",
+		DataType: vocab.WoTDataTypeInteger, Minimum: 1, Maximum: 3},
+	"DewPoint": {Description: "Dew point temperature", AtType: SarefNamespace + "Temperature"},
+	"Health": {Description: "Communication health of the device, 7 is best",
+		DataType: vocab.WoTDataTypeInteger, Minimum: 0, Maximum: 7},
+	"HeatIndex": {Description: "Apparent temperature from temperature and humidity", AtType: SarefNamespace + "Temperature"},
+	"Humidex":   {Description: "Canadian humidex", AtType: SarefNamespace + "Temperature"},
+	"Humidity":  {Description: "Relative humidity", AtType: SarefNamespace + "Humidity"},
+	"LED": {Description: "LED is on", DataType: vocab.WoTDataTypeInteger,
+		Enum: []interface{}{0, 1}},
+	"LEDFunction": {Description: "Function of the LED, see the device manual",
+		DataType: vocab.WoTDataTypeInteger, Enum: []interface{}{0, 1, 2, 3}},
+	"LEDState": {Description: "LED state when under manual control",
+		DataType: vocab.WoTDataTypeInteger, Enum: []interface{}{0, 1}},
+	"Light": {Description: "Light level", AtType: SarefNamespace + "Light"},
+	"Relay": {Description: "Relay is energized", DataType: vocab.WoTDataTypeInteger,
+		Enum: []interface{}{0, 1}},
+	"RelayFunction": {Description: "Function of the relay, see the device manual",
+		DataType: vocab.WoTDataTypeInteger, Enum: []interface{}{0, 1, 2, 3}},
+	"RelayState": {Description: "Relay state when under manual control", AtType: SarefNamespace + "OnOffState"},
+	"Resolution": {Description: "Temperature conversion resolution in bits",
+		DataType: vocab.WoTDataTypeInteger, Minimum: 9, Maximum: 12},
+	"Temperature": {Description: "Temperature", AtType: SarefNamespace + "Temperature"},
+	"UserByte1": {Description: "User data byte stored in the device",
+		DataType: vocab.WoTDataTypeInteger, Minimum: 0, Maximum: 255},
+	"UserByte2": {Description: "User data byte stored in the device",
+		DataType: vocab.WoTDataTypeInteger, Minimum: 0, Maximum: 255},
+}
+
+// GetAttrInfo returns the description, semantic type and constraints of an OWServer attribute
+//  edsName is the attribute name used by the OWServer, eg TemperatureHighAlarmState
+func GetAttrInfo(edsName string) (info AttrInfo, found bool) {
+	info, found = AttrInfoVocab[edsName]
+	if found {
+		return info, found
+	}
+	found = true
+	if strings.HasSuffix(edsName, "AlarmState") {
+		info = AttrInfo{Description: "1 when the alarm is active",
+			DataType: vocab.WoTDataTypeInteger, Enum: []interface{}{0, 1}}
+	} else if strings.HasSuffix(edsName, "ConditionalSearchState") {
+		info = AttrInfo{Description: "1 when the alarm is included in the conditional search",
+			DataType: vocab.WoTDataTypeInteger, Enum: []interface{}{0, 1}}
+	} else if strings.HasSuffix(edsName, "AlarmValue") {
+		info = AttrInfo{Description: "Threshold of the alarm", DataType: vocab.WoTDataTypeNumber}
+	} else {
+		found = false
+	}
+	return info, found
+}
+
 // UnitNameVocab maps OWServer unit names to IoT vocabulary
 var UnitNameVocab = map[string]string{
 	"PercentRelativeHumidity": vocab.UnitNamePercent,
@@ -100,12 +182,16 @@ type XMLNode struct {
 
 // OneWireAttr with info on each node attribute
 type OneWireAttr struct {
-	Name     string
-	Unit     string
-	Writable bool
-	Value    string
-	IsSensor bool   // sensors emit events on change
-	DataType string // vocab data type, "string", "number", "boolean"
+	Name      string
+	Unit      string
+	Writable  bool
+	Value     string
+	RawValue  string   // value as reported by the gateway, before rounding
+	IsSensor  bool     // sensors emit events on change
+	IsCounter bool     // pulse counters are published as totals and rates
+	DataType  string   // vocab data type, "string", "number", "boolean"
+	Decimals  int      // number of decimals of sensor values, -1 if values are not rounded
+	Info      AttrInfo // description, semantic type and constraints
 }
 
 // OneWireNode with info on each node
@@ -136,7 +222,6 @@ func LookupEdsName(name string) string {
 	for edsName, sensorInfo := range SensorTypeVocab {
 		if sensorInfo.name == name {
 			return edsName
-			break
 		}
 	}
 	return name
@@ -183,12 +268,37 @@ func (edsAPI *EdsAPI) Discover() (addr string, err error) {
 	}
 }
 
+// FormatValue rounds a sensor value to the given number of decimals and returns it as text
+func FormatValue(value float64, decimals int) string {
+	ratio := math.Pow(10, float64(decimals))
+	value = math.Round(value*ratio) / ratio
+	return strconv.FormatFloat(value, 'f', decimals, 32)
+}
+
 // GetLastAddress returns the last used address of the gateway
 // This is either the configured or the discovered address
 func (edsAPI *EdsAPI) GetLastAddress() string {
 	return edsAPI.address
 }
 
+// SetAddress changes the address of the gateway
+//  address is the (IP) address or filename (file://./path/to/name.xml), "" to auto discover
+func (edsAPI *EdsAPI) SetAddress(address string) {
+	edsAPI.readMutex.Lock()
+	defer edsAPI.readMutex.Unlock()
+	edsAPI.address = address
+}
+
+// SetLogin changes the Basic Auth credentials of the gateway
+//  loginName if needed, "" if not needed
+//  password if needed, "" if not needed
+func (edsAPI *EdsAPI) SetLogin(loginName string, password string) {
+	edsAPI.readMutex.Lock()
+	defer edsAPI.readMutex.Unlock()
+	edsAPI.loginName = loginName
+	edsAPI.password = password
+}
+
 // ParseOneWireNodes parses the owserver xml data and returns a list of nodes,
 // including the owserver gateway, and their parameters.
 // This also converts sensor values to a proper decimals. Eg temperature isn't 4 digits but 1.
@@ -224,9 +334,13 @@ func (edsAPI *EdsAPI) ParseOneWireNodes(xmlNode *XMLNode, latency time.Duration,
 			writable := (strings.ToLower(node.Writable) == "true")
 			attrName := node.XMLName.Local
 			sensorInfo, isSensor := SensorTypeVocab[attrName]
+			counterName, isCounter := CounterVocab[attrName]
 			decimals := -1 // -1 means no conversion
 			dataType := vocab.WoTDataTypeString
-			if isSensor {
+			if isCounter {
+				attrName = counterName
+				dataType = vocab.WoTDataTypeNumber
+			} else if isSensor {
 				// this is a known sensor type. (writable sensors are actuators)
 				attrName = sensorInfo.name
 				decimals = sensorInfo.decimals
@@ -235,24 +349,33 @@ func (edsAPI *EdsAPI) ParseOneWireNodes(xmlNode *XMLNode, latency time.Duration,
 				// this is an attribute. writable attributes are configuration
 				attrName, _ = applyVocabulary(attrName, AttrVocab)
 			}
+			info, hasInfo := GetAttrInfo(node.XMLName.Local)
+			if node.Description != "" {
+				info.Description = node.Description
+			}
+			if hasInfo && info.DataType != "" && !isSensor && !isCounter {
+				dataType = info.DataType
+			}
 			if attrName != "" {
 				unit, _ := applyVocabulary(node.Units, UnitNameVocab)
 				valueStr := string(node.Content)
 				valueFloat, err := strconv.ParseFloat(valueStr, 32)
 				// rounding of sensor values to decimals
 				if err == nil && decimals >= 0 {
-					ratio := math.Pow(10, float64(decimals))
-					valueFloat = math.Round(valueFloat*ratio) / ratio
-					valueStr = strconv.FormatFloat(valueFloat, 'f', decimals, 32)
+					valueStr = FormatValue(valueFloat, decimals)
 				}
 
 				owAttr := OneWireAttr{
-					Name:     attrName,
-					Value:    valueStr,
-					Unit:     unit,
-					IsSensor: isSensor,
-					Writable: writable,
-					DataType: dataType,
+					Name:      attrName,
+					Value:     valueStr,
+					RawValue:  string(node.Content),
+					Unit:      unit,
+					IsSensor:  isSensor,
+					IsCounter: isCounter,
+					Writable:  writable,
+					DataType:  dataType,
+					Decimals:  decimals,
+					Info:      info,
 				}
 				owNode.Attr[owAttr.Name] = owAttr
 				// Family is used to determine device type, default is gateway
@@ -283,6 +406,25 @@ func (edsAPI *EdsAPI) ParseOneWireNodes(xmlNode *XMLNode, latency time.Duration,
 	return owNodeList
 }
 
+// PollNodes polls the OWServer gateway for the 1-wire nodes and their attribute values
+// The latency of reading the gateway is added to the gateway node.
+// Returns the list of nodes, including the gateway node.
+func (edsAPI *EdsAPI) PollNodes() ([]*OneWireNode, error) {
+	logrus.Infof("EdsAPI.PollNodes")
+
+	// Read the values from the EDS gateway
+	startTime := time.Now()
+	rootNode, err := edsAPI.ReadEds()
+	endTime := time.Now()
+	latency := endTime.Sub(startTime)
+	if err != nil {
+		return nil, err
+	}
+	// Extract the nodes and convert properties to vocab names
+	nodeList := edsAPI.ParseOneWireNodes(rootNode, latency, true)
+	return nodeList, nil
+}
+
 // PollValues polls the OWServer gateway for Thing property values
 // Returns a map of device/node ID's containing a map of property name:value pairs
 // eg: map[nodeID](map[propName]propValue)
@@ -292,16 +434,10 @@ func (edsAPI *EdsAPI) PollValues() (map[string](map[string]interface{}), error)
 	// thingValues is a map of NodeID:{attr:value,...}
 	thingValues := make(map[string](map[string]interface{}))
 
-	// Read the values from the EDS gateway
-	startTime := time.Now()
-	rootNode, err := edsAPI.ReadEds()
-	endTime := time.Now()
-	latency := endTime.Sub(startTime)
+	nodeList, err := edsAPI.PollNodes()
 	if err != nil {
 		return nil, err
 	}
-	// Extract the nodes and convert properties to vocab names
-	nodeList := edsAPI.ParseOneWireNodes(rootNode, latency, true)
 	for _, node := range nodeList {
 		propValues := make(map[string]interface{})
 		for name, attr := range node.Attr {
@@ -371,7 +507,7 @@ func (edsAPI *EdsAPI) WriteData(romID string, variable string, value string) err
 		"?rom=" + romID + "&variable=" + variable + "&value=" + value
 	req, _ := http.NewRequest("GET", writeURL, nil)
 
-	logrus.Infof("URL: %s", writeURL)
+	logrus.Infof("Writing '%s' of device %s", variable, romID)
 	req.SetBasicAuth(edsAPI.loginName, edsAPI.password)
 	client := &http.Client{Timeout: time.Second}
 	resp, err := client.Do(req)
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/wost-go/pkg/vocab"
 )
 
 // Some tests require a living OWServer
@@ -80,6 +81,34 @@ func TestParseNodeFile(t *testing.T) {
 	assert.Lenf(t, deviceNodes, 4, "Expected 4 nodes")
 }
 
+// TestAttrInfo checks that parsed attributes have their description and constraints
+func TestAttrInfo(t *testing.T) {
+	edsAPI := eds.NewEdsAPI("file://"+owserverSimulation, "", "")
+	rootNode, err := edsAPI.ReadEds()
+	require.NoError(t, err)
+	deviceNodes := edsAPI.ParseOneWireNodes(rootNode, 0, true)
+	var ds18b20, eds0068 *eds.OneWireNode
+	for _, node := range deviceNodes {
+		if node.NodeID == "2A000003BB170B28" {
+			ds18b20 = node
+		} else if node.NodeID == "C100100000267C7E" {
+			eds0068 = node
+		}
+	}
+	require.NotNil(t, ds18b20)
+	require.NotNil(t, eds0068)
+
+	userByte := ds18b20.Attr["UserByte1"]
+	assert.Equal(t, vocab.WoTDataTypeInteger, userByte.DataType)
+	assert.True(t, userByte.Info.HasRange())
+	assert.Equal(t, 255.0, userByte.Info.Maximum)
+	assert.Equal(t, eds.SarefNamespace+"Temperature", ds18b20.Attr[vocab.PropNameTemperature].Info.AtType)
+
+	alarmState := eds0068.Attr["TemperatureHighAlarmState"]
+	assert.Equal(t, []interface{}{0, 1}, alarmState.Info.Enum)
+	assert.NotEmpty(t, alarmState.Info.Description)
+}
+
 // TestPollValues reads the EDS and extracts property values of each node
 func TestPollValues(t *testing.T) {
 	edsAddress := "file://" + owserverSimulation
@@ -98,3 +127,13 @@ func TestWriteDataFail(t *testing.T) {
 	err := edsAPI.WriteData("badRomID", "temp", "")
 	assert.Error(t, err)
 }
+
+// TestPollNodes reads the EDS and returns the parsed nodes including the gateway
+func TestPollNodes(t *testing.T) {
+	edsAddress := "file://" + owserverSimulation
+	edsAPI := eds.NewEdsAPI(edsAddress, "", "")
+
+	nodeList, err := edsAPI.PollNodes()
+	assert.NoError(t, err)
+	assert.Len(t, nodeList, 4)
+}
@@ -0,0 +1,74 @@
+// Package envconfig overrides configuration settings with environment variables
+package envconfig
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/wostzone/owserver/internal/configcheck"
+)
+
+// EnvVarName returns the environment variable name of a setting
+// The name is the prefix followed by the setting name in upper snake case, eg with prefix
+// "OWSERVER_" the setting 'valueInterval' becomes OWSERVER_VALUE_INTERVAL.
+//  prefix of the variable name, eg "OWSERVER_"
+//  settingName is the name of the setting in the configuration file, eg valueInterval
+func EnvVarName(prefix string, settingName string) string {
+	var name strings.Builder
+	name.WriteString(prefix)
+	var prev rune
+	for _, c := range settingName {
+		if unicode.IsUpper(c) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) {
+			name.WriteRune('_')
+		}
+		name.WriteRune(unicode.ToUpper(c))
+		prev = c
+	}
+	return name.String()
+}
+
+// ApplyEnv overrides the settings of a configuration struct with environment variables
+// Each top-level field with a yaml tag can be set with the variable named by EnvVarName.
+// String settings are set to the value as is, so passwords like '#abc', 'null' or 'a: b' are
+// kept. Other values are parsed as YAML, so lists and maps can be set too, eg "{temperature: 0.2}".
+//  target is a pointer to the configuration struct
+//  prefix of the variable names, eg "OWSERVER_"
+//  lookupEnv returns the value of a variable, eg os.LookupEnv
+// This returns the names of the overridden settings and the variables that can't be parsed.
+func ApplyEnv(target interface{}, prefix string,
+	lookupEnv func(name string) (string, bool)) (applied []string, problems configcheck.Problems) {
+
+	applied = make([]string, 0)
+	problems = configcheck.Problems{}
+	targetValue := reflect.ValueOf(target).Elem()
+	targetType := targetValue.Type()
+	for i := 0; i < targetType.NumField(); i++ {
+		settingName := strings.Split(targetType.Field(i).Tag.Get("yaml"), ",")[0]
+		if settingName == "" || settingName == "-" {
+			continue
+		}
+		varName := EnvVarName(prefix, settingName)
+		text, found := lookupEnv(varName)
+		if !found {
+			continue
+		}
+		if targetValue.Field(i).Kind() == reflect.String {
+			targetValue.Field(i).SetString(text)
+			applied = append(applied, settingName)
+			continue
+		}
+		// decode into a new value so a parse error leaves the setting unchanged
+		newValue := reflect.New(targetType.Field(i).Type)
+		err := yaml.Unmarshal([]byte(text), newValue.Interface())
+		if err != nil {
+			problems.Add(settingName, "environment variable %s can't be parsed: %s", varName, err)
+			continue
+		}
+		targetValue.Field(i).Set(newValue.Elem())
+		applied = append(applied, settingName)
+	}
+	return applied, problems
+}
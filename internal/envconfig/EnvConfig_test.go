@@ -0,0 +1,72 @@
+package envconfig_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/envconfig"
+)
+
+type testConfig struct {
+	ClientID      string             `yaml:"clientID,omitempty"`
+	EdsAddress    string             `yaml:"owserverAddress,omitempty"`
+	Password      string             `yaml:"password,omitempty"`
+	ValueInterval int                `yaml:"valueInterval,omitempty"`
+	PrettyJSON    bool               `yaml:"prettyJSON,omitempty"`
+	Deadbands     map[string]float64 `yaml:"deadbands,omitempty"`
+	Untagged      string
+}
+
+func TestEnvVarName(t *testing.T) {
+	assert.Equal(t, "OWSERVER_VALUE_INTERVAL", envconfig.EnvVarName("OWSERVER_", "valueInterval"))
+	assert.Equal(t, "OWSERVER_CLIENT_ID", envconfig.EnvVarName("OWSERVER_", "clientID"))
+	assert.Equal(t, "OWSERVER_PRETTY_JSON", envconfig.EnvVarName("OWSERVER_", "prettyJSON"))
+	assert.Equal(t, "OWSERVER_LEGACY_THING_IDS_UNTIL", envconfig.EnvVarName("OWSERVER_", "legacyThingIDsUntil"))
+	assert.Equal(t, "PASSWORD_FILE", envconfig.EnvVarName("", "passwordFile"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"OWSERVER_OWSERVER_ADDRESS": "192.168.1.10",
+		"OWSERVER_VALUE_INTERVAL":   "notanumber",
+		"OWSERVER_PRETTY_JSON":      "true",
+		"OWSERVER_DEADBANDS":        "{temperature: 0.2}",
+		"OWSERVER_UNTAGGED":         "ignored",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+	cfg := testConfig{ClientID: "owserver-1", ValueInterval: 30}
+	applied, problems := envconfig.ApplyEnv(&cfg, "OWSERVER_", lookupEnv)
+	assert.Equal(t, []string{"owserverAddress", "prettyJSON", "deadbands"}, applied)
+	require.Len(t, problems, 1)
+	assert.Equal(t, "valueInterval", problems[0].Path)
+
+	assert.Equal(t, "owserver-1", cfg.ClientID)
+	assert.Equal(t, "192.168.1.10", cfg.EdsAddress)
+	assert.Equal(t, 30, cfg.ValueInterval)
+	assert.True(t, cfg.PrettyJSON)
+	assert.Equal(t, map[string]float64{"temperature": 0.2}, cfg.Deadbands)
+	assert.Equal(t, "", cfg.Untagged)
+}
+
+func TestApplyEnvStringsVerbatim(t *testing.T) {
+	// values that YAML would turn into null, fail to parse or unquote
+	passwords := []string{"#abc", "null", "~", "*abc", "a: b", "{x}", "'q'", `"q"`, "", " padded "}
+	for _, password := range passwords {
+		lookupEnv := func(name string) (string, bool) {
+			if name == "OWSERVER_PASSWORD" {
+				return password, true
+			}
+			return "", false
+		}
+		cfg := testConfig{Password: "old"}
+		applied, problems := envconfig.ApplyEnv(&cfg, "OWSERVER_", lookupEnv)
+		assert.Empty(t, problems, password)
+		assert.Equal(t, []string{"password"}, applied)
+		assert.Equal(t, password, cfg.Password)
+	}
+}
@@ -0,0 +1,7 @@
+package internal
+
+// SetGatewayAddress changes the address used to read the gateway without changing the
+// configuration, as discovery of the gateway does
+func (pb *OWServerPB) SetGatewayAddress(address string) {
+	pb.edsAPI.SetAddress(address)
+}
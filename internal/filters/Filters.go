@@ -0,0 +1,236 @@
+// Package filters with smoothing filters for noisy sensor values
+package filters
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Filter types
+const (
+	FilterTypeMovingAverage = "movingAverage"
+	FilterTypeMedian        = "median"
+	FilterTypeExponential   = "exponential"
+)
+
+// Default filter settings
+const (
+	DefaultSize  = 5
+	DefaultAlpha = 0.3
+)
+
+// Config of a sensor filter
+type Config struct {
+	// Type of filter: movingAverage, median or exponential
+	Type string `yaml:"type"`
+	// Size is the number of samples of the moving average and median filters, default is 5
+	Size int `yaml:"size,omitempty"`
+	// Alpha is the smoothing factor of the exponential filter, between 0 and 1, default is 0.3.
+	// Smaller values give smoother results.
+	Alpha float64 `yaml:"alpha,omitempty"`
+	// PublishRaw publishes the unfiltered value next to the filtered value, default is false
+	PublishRaw bool `yaml:"publishRaw,omitempty"`
+}
+
+// Filter smooths a series of values
+type Filter interface {
+	// Add a value and return the filtered value
+	Add(value float64) float64
+}
+
+// MovingAverage filter returns the average of the last N values
+type MovingAverage struct {
+	samples []float64
+	size    int
+}
+
+// Add a value and return the average of the last N values
+func (f *MovingAverage) Add(value float64) float64 {
+	f.samples = append(f.samples, value)
+	if len(f.samples) > f.size {
+		f.samples = f.samples[1:]
+	}
+	sum := 0.0
+	for _, sample := range f.samples {
+		sum += sample
+	}
+	return sum / float64(len(f.samples))
+}
+
+// Median filter returns the median of the last N values. This removes single spikes.
+type Median struct {
+	samples []float64
+	size    int
+}
+
+// Add a value and return the median of the last N values
+func (f *Median) Add(value float64) float64 {
+	f.samples = append(f.samples, value)
+	if len(f.samples) > f.size {
+		f.samples = f.samples[1:]
+	}
+	sorted := append([]float64(nil), f.samples...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// Exponential smoothing filter
+type Exponential struct {
+	alpha    float64
+	value    float64
+	hasValue bool
+}
+
+// Add a value and return the exponentially smoothed value
+func (f *Exponential) Add(value float64) float64 {
+	if !f.hasValue {
+		f.value = value
+		f.hasValue = true
+	} else {
+		f.value = f.alpha*value + (1-f.alpha)*f.value
+	}
+	return f.value
+}
+
+// NewFilter creates a filter from its configuration
+func NewFilter(config Config) (Filter, error) {
+	size := config.Size
+	if size <= 0 {
+		size = DefaultSize
+	}
+	switch config.Type {
+	case FilterTypeMovingAverage:
+		return &MovingAverage{size: size}, nil
+	case FilterTypeMedian:
+		return &Median{size: size}, nil
+	case FilterTypeExponential:
+		alpha := config.Alpha
+		if alpha == 0 {
+			alpha = DefaultAlpha
+		}
+		if alpha < 0 || alpha > 1 {
+			return nil, fmt.Errorf("exponential filter alpha '%f' must be between 0 and 1", alpha)
+		}
+		return &Exponential{alpha: alpha}, nil
+	}
+	return nil, fmt.Errorf("unknown filter type '%s'", config.Type)
+}
+
+// FilterStore holds the filter of each sensor
+type FilterStore struct {
+	// filter configuration by sensor property name
+	sensorConfig map[string]Config
+	// filter configuration by ROM ID and sensor property name. These override the sensor configuration.
+	deviceConfig map[string]map[string]Config
+	// filters by ROM ID and property name
+	filters map[string]map[string]Filter
+	mu      sync.Mutex
+}
+
+// GetConfig returns the filter configuration of a device sensor and whether it has a filter
+// Device configuration takes precedence over sensor configuration.
+func (fs *FilterStore) GetConfig(romID string, propName string) (config Config, found bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.getConfig(romID, propName)
+}
+
+// getConfig returns the filter configuration of a device sensor without locking
+func (fs *FilterStore) getConfig(romID string, propName string) (config Config, found bool) {
+	config, found = fs.deviceConfig[romID][propName]
+	if !found {
+		config, found = fs.sensorConfig[propName]
+	}
+	return config, found
+}
+
+// Apply the filter of a device sensor to a value
+// This returns the filtered value, or the value itself if the sensor has no (valid) filter.
+func (fs *FilterStore) Apply(romID string, propName string, value float64) (filtered float64, hasFilter bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	config, found := fs.getConfig(romID, propName)
+	if !found {
+		return value, false
+	}
+	deviceFilters, found := fs.filters[romID]
+	if !found {
+		deviceFilters = make(map[string]Filter)
+		fs.filters[romID] = deviceFilters
+	}
+	filter, found := deviceFilters[propName]
+	if !found {
+		var err error
+		filter, err = NewFilter(config)
+		if err != nil {
+			return value, false
+		}
+		deviceFilters[propName] = filter
+	}
+	return filter.Add(value), true
+}
+
+// SetConfig replaces the filter configuration
+// Filters whose configuration changed restart with the next value. Other filters keep their samples.
+// Invalid filter configurations are logged and ignored.
+//  sensorConfig with filter configuration by sensor property name, eg humidity. nil for none.
+//  deviceConfig with filter configuration by ROM ID and property name. nil for none.
+func (fs *FilterStore) SetConfig(sensorConfig map[string]Config, deviceConfig map[string]map[string]Config) {
+	logInvalidConfig(sensorConfig, deviceConfig)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	oldConfig := make(map[string]map[string]Config)
+	for romID, deviceFilters := range fs.filters {
+		oldConfig[romID] = make(map[string]Config)
+		for propName := range deviceFilters {
+			oldConfig[romID][propName], _ = fs.getConfig(romID, propName)
+		}
+	}
+	fs.sensorConfig = sensorConfig
+	fs.deviceConfig = deviceConfig
+	for romID, deviceFilters := range fs.filters {
+		for propName := range deviceFilters {
+			newConfig, found := fs.getConfig(romID, propName)
+			if !found || newConfig != oldConfig[romID][propName] {
+				delete(deviceFilters, propName)
+			}
+		}
+	}
+}
+
+// logInvalidConfig logs the filter configurations that are invalid
+func logInvalidConfig(sensorConfig map[string]Config, deviceConfig map[string]map[string]Config) {
+	for propName, config := range sensorConfig {
+		if _, err := NewFilter(config); err != nil {
+			logrus.Errorf("Ignoring filter of sensor '%s': %s", propName, err)
+		}
+	}
+	for romID, deviceConfig := range deviceConfig {
+		for propName, config := range deviceConfig {
+			if _, err := NewFilter(config); err != nil {
+				logrus.Errorf("Ignoring filter of '%s' of device '%s': %s", propName, romID, err)
+			}
+		}
+	}
+}
+
+// NewFilterStore creates a store for sensor filters
+// Invalid filter configurations are logged and ignored.
+//  sensorConfig with filter configuration by sensor property name, eg humidity. nil for none.
+//  deviceConfig with filter configuration by ROM ID and property name. nil for none.
+func NewFilterStore(sensorConfig map[string]Config, deviceConfig map[string]map[string]Config) *FilterStore {
+	fs := &FilterStore{
+		sensorConfig: sensorConfig,
+		deviceConfig: deviceConfig,
+		filters:      make(map[string]map[string]Filter),
+	}
+	logInvalidConfig(sensorConfig, deviceConfig)
+	return fs
+}
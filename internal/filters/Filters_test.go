@@ -0,0 +1,92 @@
+package filters_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/filters"
+)
+
+const testDevice = "C100100000267C7E"
+const testProp = "humidity"
+
+func TestMovingAverage(t *testing.T) {
+	f, err := filters.NewFilter(filters.Config{Type: filters.FilterTypeMovingAverage, Size: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, f.Add(10))
+	assert.Equal(t, 15.0, f.Add(20))
+	assert.Equal(t, 20.0, f.Add(30))
+	// oldest value drops out
+	assert.Equal(t, 30.0, f.Add(40))
+}
+
+func TestMedian(t *testing.T) {
+	f, err := filters.NewFilter(filters.Config{Type: filters.FilterTypeMedian, Size: 3})
+	require.NoError(t, err)
+	f.Add(10)
+	f.Add(11)
+	// single spike is removed
+	assert.Equal(t, 11.0, f.Add(90))
+	assert.Equal(t, 12.0, f.Add(12))
+}
+
+func TestExponential(t *testing.T) {
+	f, err := filters.NewFilter(filters.Config{Type: filters.FilterTypeExponential, Alpha: 0.5})
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, f.Add(10))
+	assert.Equal(t, 15.0, f.Add(20))
+
+	_, err = filters.NewFilter(filters.Config{Type: filters.FilterTypeExponential, Alpha: 2})
+	assert.Error(t, err)
+	_, err = filters.NewFilter(filters.Config{Type: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestFilterStore(t *testing.T) {
+	sensorConfig := map[string]filters.Config{
+		testProp: {Type: filters.FilterTypeMovingAverage, Size: 2},
+	}
+	deviceConfig := map[string]map[string]filters.Config{
+		"otherDevice": {testProp: {Type: filters.FilterTypeMedian}},
+	}
+	fs := filters.NewFilterStore(sensorConfig, deviceConfig)
+	fs.Apply(testDevice, testProp, 40)
+	value, hasFilter := fs.Apply(testDevice, testProp, 50)
+	assert.True(t, hasFilter)
+	assert.Equal(t, 45.0, value)
+
+	config, _ := fs.GetConfig("otherDevice", testProp)
+	assert.Equal(t, filters.FilterTypeMedian, config.Type)
+
+	value, hasFilter = fs.Apply(testDevice, "temperature", 20)
+	assert.False(t, hasFilter)
+	assert.Equal(t, 20.0, value)
+}
+
+func TestSetConfig(t *testing.T) {
+	sensorConfig := map[string]filters.Config{
+		testProp:      {Type: filters.FilterTypeMovingAverage, Size: 2},
+		"temperature": {Type: filters.FilterTypeMovingAverage, Size: 2},
+	}
+	fs := filters.NewFilterStore(sensorConfig, nil)
+	fs.Apply(testDevice, testProp, 40)
+	fs.Apply(testDevice, "temperature", 10)
+
+	// the unchanged filter keeps its samples, the changed filter restarts
+	fs.SetConfig(map[string]filters.Config{
+		testProp:      {Type: filters.FilterTypeMovingAverage, Size: 2},
+		"temperature": {Type: filters.FilterTypeMovingAverage, Size: 3},
+	}, nil)
+	value, _ := fs.Apply(testDevice, testProp, 50)
+	assert.Equal(t, 45.0, value)
+	value, _ = fs.Apply(testDevice, "temperature", 20)
+	assert.Equal(t, 20.0, value)
+
+	// removed filters no longer apply
+	fs.SetConfig(nil, nil)
+	value, hasFilter := fs.Apply(testDevice, testProp, 60)
+	assert.False(t, hasFilter)
+	assert.Equal(t, 60.0, value)
+}
@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/sdnotify"
 )
 
 // heartbeat polls the EDS server every X seconds and updates the Exposed Things
@@ -12,13 +14,35 @@ func (pb *OWServerPB) heartBeat() {
 		pb.Config.TDInterval, pb.Config.ValueInterval)
 	var tdCountDown = 0
 	var valueCountDown = 0
+	var metricsCountDown = 0
+	// ping the systemd watchdog while the heartbeat makes progress
+	var watchdogInterval = sdnotify.WatchdogInterval()
+	var lastWatchdog time.Time
+	// systemd is notified that the service is ready after the first successful readiness check
+	var isReady = false
 	for {
+		now := time.Now()
+		if watchdogInterval > 0 && now.Sub(lastWatchdog) >= watchdogInterval {
+			NotifySystemd(sdnotify.StateWatchdog)
+			lastWatchdog = now
+		}
 		pb.mu.Lock()
+		pb.lastHeartbeat = now
 		isRunning := pb.running
+		tdInterval := pb.Config.TDInterval
+		valueInterval := pb.Config.ValueInterval
+		metricsInterval := pb.Config.MetricsInterval
 		pb.mu.Unlock()
 		if !isRunning {
 			break
 		}
+		// intervals can be shortened at runtime
+		if tdCountDown > tdInterval {
+			tdCountDown = tdInterval
+		}
+		if valueCountDown > valueInterval {
+			valueCountDown = valueInterval
+		}
 
 		tdCountDown--
 		if tdCountDown <= 0 {
@@ -26,15 +50,27 @@ func (pb *OWServerPB) heartBeat() {
 			// create ExposedThing's as they are discovered
 			_ = pb.UpdateExposedThings()
 			_ = pb.UpdatePropertyValues(false)
-			tdCountDown = pb.Config.TDInterval
-			valueCountDown = pb.Config.ValueInterval
+			_ = pb.history.Save()
+			_ = pb.counters.Save()
+			_ = pb.inventory.Save()
+			tdCountDown = tdInterval
+			valueCountDown = valueInterval
 		} else {
 			valueCountDown--
 			if valueCountDown <= 0 {
 				_ = pb.UpdatePropertyValues(true)
-				valueCountDown = pb.Config.ValueInterval
+				valueCountDown = valueInterval
 			}
 		}
+		metricsCountDown--
+		if metricsCountDown <= 0 {
+			_ = pb.PublishMetrics()
+			metricsCountDown = metricsInterval
+		}
+		if !isReady && pb.CheckReadiness(time.Now()) == nil {
+			NotifySystemd(sdnotify.StateReady)
+			isReady = true
+		}
 		time.Sleep(time.Second)
 	}
 }
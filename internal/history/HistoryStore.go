@@ -0,0 +1,236 @@
+// Package history with a bounded in-memory history of sensor values
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sample with a single sensor value and the time it was obtained
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// ringBuffer holds the most recent samples of a single sensor.
+// When full, the oldest sample is overwritten.
+type ringBuffer struct {
+	samples []Sample
+	start   int // index of the oldest sample
+	count   int // number of samples in the buffer
+}
+
+// add a sample, overwriting the oldest sample if the buffer is full
+func (rb *ringBuffer) add(sample Sample) {
+	size := len(rb.samples)
+	if rb.count < size {
+		rb.samples[(rb.start+rb.count)%size] = sample
+		rb.count++
+	} else {
+		rb.samples[rb.start] = sample
+		rb.start = (rb.start + 1) % size
+	}
+}
+
+// dropBefore removes the samples older than the given time
+func (rb *ringBuffer) dropBefore(oldest time.Time) {
+	size := len(rb.samples)
+	for rb.count > 0 && rb.samples[rb.start].Time.Before(oldest) {
+		rb.start = (rb.start + 1) % size
+		rb.count--
+	}
+}
+
+// list returns the samples in chronological order
+func (rb *ringBuffer) list() []Sample {
+	size := len(rb.samples)
+	list := make([]Sample, 0, rb.count)
+	for i := 0; i < rb.count; i++ {
+		list = append(list, rb.samples[(rb.start+i)%size])
+	}
+	return list
+}
+
+// HistoryStore holds a bounded history of sensor values for each device.
+// The history of each sensor is limited in number of samples and in age of the samples.
+type HistoryStore struct {
+	// maximum number of samples to keep per sensor
+	maxSize int
+	// maximum age of samples to keep. 0 to keep samples until the buffer is full.
+	maxAge time.Duration
+	// file to persist the history in. "" to not persist.
+	filename string
+	// history buffers by device ID and property name
+	buffers map[string]map[string]*ringBuffer
+	mu      sync.RWMutex
+}
+
+// Add a sensor value to the history of a device
+//  deviceID is the ID of the device whose sensor value to add
+//  propName is the name of the sensor property
+//  value is the sensor value
+//  timestamp is the time the value was obtained
+func (hs *HistoryStore) Add(deviceID string, propName string, value float64, timestamp time.Time) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	deviceBuffers, found := hs.buffers[deviceID]
+	if !found {
+		deviceBuffers = make(map[string]*ringBuffer)
+		hs.buffers[deviceID] = deviceBuffers
+	}
+	rb, found := deviceBuffers[propName]
+	if !found {
+		rb = &ringBuffer{samples: make([]Sample, hs.maxSize)}
+		deviceBuffers[propName] = rb
+	}
+	rb.add(Sample{Time: timestamp, Value: value})
+	if hs.maxAge > 0 {
+		rb.dropBefore(timestamp.Add(-hs.maxAge))
+	}
+}
+
+// GetNames returns the names of the properties of a device that have a history
+func (hs *HistoryStore) GetNames(deviceID string) []string {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	names := make([]string, 0)
+	for propName := range hs.buffers[deviceID] {
+		names = append(names, propName)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query returns the samples of a device sensor within a time range.
+// If an interval is given then the samples are downsampled by averaging the samples
+// within each interval. The time of a downsampled value is the start of its interval.
+//  deviceID is the ID of the device to query
+//  propName is the name of the sensor property to query
+//  from is the start of the time range, inclusive. Use the zero time for no lower bound.
+//  to is the end of the time range, inclusive. Use the zero time for no upper bound.
+//  interval is the downsampling interval. Use 0 to return all samples.
+// This returns the list of samples in chronological order, or an empty list if none are found.
+func (hs *HistoryStore) Query(deviceID string, propName string,
+	from time.Time, to time.Time, interval time.Duration) []Sample {
+
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	result := make([]Sample, 0)
+	rb, found := hs.buffers[deviceID][propName]
+	if !found {
+		return result
+	}
+	var oldest time.Time
+	if hs.maxAge > 0 {
+		oldest = time.Now().Add(-hs.maxAge)
+	}
+	var bucketStart time.Time
+	var bucketSum float64
+	var bucketCount int
+	for _, sample := range rb.list() {
+		if sample.Time.Before(from) || sample.Time.Before(oldest) || (!to.IsZero() && sample.Time.After(to)) {
+			continue
+		}
+		if interval <= 0 {
+			result = append(result, sample)
+			continue
+		}
+		start := sample.Time.Truncate(interval)
+		if bucketCount > 0 && !start.Equal(bucketStart) {
+			result = append(result, Sample{Time: bucketStart, Value: bucketSum / float64(bucketCount)})
+			bucketSum = 0
+			bucketCount = 0
+		}
+		bucketStart = start
+		bucketSum += sample.Value
+		bucketCount++
+	}
+	if bucketCount > 0 {
+		result = append(result, Sample{Time: bucketStart, Value: bucketSum / float64(bucketCount)})
+	}
+	return result
+}
+
+// Load the history from file, if persistence is enabled.
+// Samples that exceed the size or age limits are dropped.
+// A missing file is not an error.
+func (hs *HistoryStore) Load() error {
+	if hs.filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(hs.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		logrus.Errorf("Unable to read history from '%s': %s", hs.filename, err)
+		return err
+	}
+	saved := make(map[string]map[string][]Sample)
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		logrus.Errorf("Unable to parse history file '%s': %s", hs.filename, err)
+		return err
+	}
+	for deviceID, deviceSamples := range saved {
+		for propName, samples := range deviceSamples {
+			for _, sample := range samples {
+				hs.Add(deviceID, propName, sample.Value, sample.Time)
+			}
+		}
+	}
+	logrus.Infof("Loaded history of %d devices from '%s'", len(saved), hs.filename)
+	return nil
+}
+
+// Save the history to file, if persistence is enabled.
+// The file is first written to a temporary file and then renamed to avoid corruption.
+func (hs *HistoryStore) Save() error {
+	if hs.filename == "" {
+		return nil
+	}
+	hs.mu.RLock()
+	saved := make(map[string]map[string][]Sample)
+	for deviceID, deviceBuffers := range hs.buffers {
+		deviceSamples := make(map[string][]Sample)
+		for propName, rb := range deviceBuffers {
+			deviceSamples[propName] = rb.list()
+		}
+		saved[deviceID] = deviceSamples
+	}
+	hs.mu.RUnlock()
+
+	data, _ := json.Marshal(saved)
+	tmpName := hs.filename + ".tmp"
+	err := ioutil.WriteFile(tmpName, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpName, hs.filename)
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save history to '%s': %s", hs.filename, err)
+	}
+	return err
+}
+
+// NewHistoryStore creates a new store for the history of sensor values
+//  maxSize is the maximum number of samples to keep per sensor
+//  maxAge is the maximum age of samples to keep, 0 to only limit by size
+//  filename is the file to persist the history in, "" to not persist
+func NewHistoryStore(maxSize int, maxAge time.Duration, filename string) *HistoryStore {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	hs := &HistoryStore{
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		filename: filename,
+		buffers:  make(map[string]map[string]*ringBuffer),
+	}
+	return hs
+}
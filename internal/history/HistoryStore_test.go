@@ -0,0 +1,98 @@
+package history_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/history"
+)
+
+const testDevice = "device1"
+const testProp = "temperature"
+
+func TestAddQuery(t *testing.T) {
+	hs := history.NewHistoryStore(10, 0, "")
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		hs.Add(testDevice, testProp, float64(i), now.Add(time.Duration(i)*time.Second))
+	}
+	samples := hs.Query(testDevice, testProp, time.Time{}, time.Time{}, 0)
+	require.Len(t, samples, 5)
+	assert.Equal(t, 0.0, samples[0].Value)
+	assert.Equal(t, 4.0, samples[4].Value)
+
+	// time range is inclusive
+	samples = hs.Query(testDevice, testProp, now.Add(time.Second), now.Add(3*time.Second), 0)
+	assert.Len(t, samples, 3)
+
+	assert.Equal(t, []string{testProp}, hs.GetNames(testDevice))
+	assert.Empty(t, hs.Query("unknown", testProp, time.Time{}, time.Time{}, 0))
+}
+
+func TestRingBufferOverflow(t *testing.T) {
+	hs := history.NewHistoryStore(3, 0, "")
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		hs.Add(testDevice, testProp, float64(i), now.Add(time.Duration(i)*time.Second))
+	}
+	// only the last 3 samples remain, in order
+	samples := hs.Query(testDevice, testProp, time.Time{}, time.Time{}, 0)
+	require.Len(t, samples, 3)
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.Equal(t, 4.0, samples[2].Value)
+}
+
+func TestMaxAge(t *testing.T) {
+	hs := history.NewHistoryStore(100, time.Minute, "")
+	now := time.Now()
+	hs.Add(testDevice, testProp, 1, now.Add(-2*time.Minute))
+	hs.Add(testDevice, testProp, 2, now)
+	samples := hs.Query(testDevice, testProp, time.Time{}, time.Time{}, 0)
+	require.Len(t, samples, 1)
+	assert.Equal(t, 2.0, samples[0].Value)
+}
+
+func TestDownsample(t *testing.T) {
+	hs := history.NewHistoryStore(100, 0, "")
+	start := time.Now().Truncate(time.Minute)
+	// two samples in the first minute and one in the second
+	hs.Add(testDevice, testProp, 1, start)
+	hs.Add(testDevice, testProp, 3, start.Add(30*time.Second))
+	hs.Add(testDevice, testProp, 10, start.Add(70*time.Second))
+
+	samples := hs.Query(testDevice, testProp, time.Time{}, time.Time{}, time.Minute)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.True(t, samples[0].Time.Equal(start))
+	assert.Equal(t, 10.0, samples[1].Value)
+}
+
+func TestSaveLoad(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-history-test.json")
+	defer os.Remove(filename)
+
+	hs := history.NewHistoryStore(10, 0, filename)
+	hs.Add(testDevice, testProp, 21.5, time.Now())
+	err := hs.Save()
+	require.NoError(t, err)
+
+	hs2 := history.NewHistoryStore(10, 0, filename)
+	err = hs2.Load()
+	require.NoError(t, err)
+	samples := hs2.Query(testDevice, testProp, time.Time{}, time.Time{}, 0)
+	require.Len(t, samples, 1)
+	assert.Equal(t, 21.5, samples[0].Value)
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	hs := history.NewHistoryStore(10, 0, "/doesnotexist/history.json")
+	err := hs.Load()
+	assert.NoError(t, err)
+	err = hs.Save()
+	assert.Error(t, err)
+}
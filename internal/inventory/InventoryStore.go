@@ -0,0 +1,159 @@
+// Package inventory with the last known 1-wire nodes and their values
+package inventory
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/wostzone/owserver/internal/eds"
+)
+
+// NodeRecord with the last known information of a node
+type NodeRecord struct {
+	// Node with its attributes as last discovered
+	Node *eds.OneWireNode `json:"node"`
+	// Values with the last published property values
+	Values map[string]string `json:"values"`
+	// LastSeen is the time the node last reported its values
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// InventoryStore holds the last known nodes so they can be published while the gateway
+// cannot be reached.
+type InventoryStore struct {
+	// file to persist the inventory in. "" to not persist.
+	filename string
+	// node records by ROM ID
+	records map[string]*NodeRecord
+	mu      sync.RWMutex
+}
+
+// Get returns a copy of the record of a node, or nil if the node is unknown
+func (inv *InventoryStore) Get(romID string) *NodeRecord {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	record, found := inv.records[romID]
+	if !found {
+		return nil
+	}
+	recordCopy := *record
+	return &recordCopy
+}
+
+// GetIDs returns the ROM IDs of all known nodes
+func (inv *InventoryStore) GetIDs() []string {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	romIDs := make([]string, 0, len(inv.records))
+	for romID := range inv.records {
+		romIDs = append(romIDs, romID)
+	}
+	return romIDs
+}
+
+// Update the record of a node with its latest values
+// Values that are not strings are not kept.
+//  node with the node attributes
+//  values with the published property values of the node
+//  timestamp the values were read
+func (inv *InventoryStore) Update(node *eds.OneWireNode, values map[string]interface{}, timestamp time.Time) {
+	record := &NodeRecord{
+		Node:     node,
+		Values:   make(map[string]string),
+		LastSeen: timestamp,
+	}
+	for name, value := range values {
+		if valueStr, ok := value.(string); ok {
+			record.Values[name] = valueStr
+		}
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.records[node.NodeID] = record
+}
+
+// Remove a node from the inventory
+func (inv *InventoryStore) Remove(romID string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	delete(inv.records, romID)
+}
+
+// GetExpired returns the ROM IDs of the nodes that were last seen before the given time
+func (inv *InventoryStore) GetExpired(before time.Time) []string {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	romIDs := make([]string, 0)
+	for romID, record := range inv.records {
+		if record.LastSeen.Before(before) {
+			romIDs = append(romIDs, romID)
+		}
+	}
+	return romIDs
+}
+
+// Load the inventory from file, if persistence is enabled.
+// A missing file is not an error.
+func (inv *InventoryStore) Load() error {
+	if inv.filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(inv.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		logrus.Errorf("Unable to read node inventory from '%s': %s", inv.filename, err)
+		return err
+	}
+	records := make(map[string]*NodeRecord)
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		logrus.Errorf("Unable to parse node inventory file '%s': %s", inv.filename, err)
+		return err
+	}
+	for romID, record := range records {
+		if record.Node == nil {
+			delete(records, romID)
+		}
+	}
+	inv.mu.Lock()
+	inv.records = records
+	inv.mu.Unlock()
+	logrus.Infof("Loaded %d nodes from '%s'", len(records), inv.filename)
+	return nil
+}
+
+// Save the inventory to file, if persistence is enabled.
+func (inv *InventoryStore) Save() error {
+	if inv.filename == "" {
+		return nil
+	}
+	inv.mu.RLock()
+	data, _ := json.MarshalIndent(inv.records, "", "  ")
+	inv.mu.RUnlock()
+
+	tmpName := inv.filename + ".tmp"
+	err := ioutil.WriteFile(tmpName, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpName, inv.filename)
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save node inventory to '%s': %s", inv.filename, err)
+	}
+	return err
+}
+
+// NewInventoryStore creates a store for the node inventory
+//  filename is the file to persist the inventory in, "" to not persist
+func NewInventoryStore(filename string) *InventoryStore {
+	inv := &InventoryStore{
+		filename: filename,
+		records:  make(map[string]*NodeRecord),
+	}
+	return inv
+}
@@ -0,0 +1,74 @@
+package inventory_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/eds"
+	"github.com/wostzone/owserver/internal/inventory"
+)
+
+const testDevice = "2A000003BB170B28"
+
+func createTestNode() *eds.OneWireNode {
+	return &eds.OneWireNode{
+		NodeID: testDevice,
+		Name:   "DS18B20",
+		Attr: map[string]eds.OneWireAttr{
+			"temperature": {Name: "Temperature", Value: "20.5", IsSensor: true},
+		},
+	}
+}
+
+func TestUpdateGet(t *testing.T) {
+	inv := inventory.NewInventoryStore("")
+	now := time.Now()
+	values := map[string]interface{}{"temperature": "20.5", "rejectedReadings": 0}
+	inv.Update(createTestNode(), values, now)
+
+	record := inv.Get(testDevice)
+	require.NotNil(t, record)
+	assert.Equal(t, "20.5", record.Values["temperature"])
+	// only string values are kept
+	assert.NotContains(t, record.Values, "rejectedReadings")
+	assert.Equal(t, []string{testDevice}, inv.GetIDs())
+
+	inv.Remove(testDevice)
+	assert.Nil(t, inv.Get(testDevice))
+}
+
+func TestGetExpired(t *testing.T) {
+	inv := inventory.NewInventoryStore("")
+	lastSeen := time.Now().Add(-2 * time.Hour)
+	inv.Update(createTestNode(), map[string]interface{}{}, lastSeen)
+
+	assert.Empty(t, inv.GetExpired(lastSeen))
+	assert.Equal(t, []string{testDevice}, inv.GetExpired(lastSeen.Add(time.Second)))
+	inv.Remove(testDevice)
+	assert.Empty(t, inv.GetExpired(time.Now()))
+}
+
+func TestSaveLoad(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-inventory-test.json")
+	defer os.Remove(filename)
+	now := time.Now()
+
+	inv := inventory.NewInventoryStore(filename)
+	inv.Update(createTestNode(), map[string]interface{}{"temperature": "20.5"}, now)
+	err := inv.Save()
+	require.NoError(t, err)
+
+	inv2 := inventory.NewInventoryStore(filename)
+	err = inv2.Load()
+	require.NoError(t, err)
+	record := inv2.Get(testDevice)
+	require.NotNil(t, record)
+	assert.Equal(t, "DS18B20", record.Node.Name)
+	assert.Equal(t, "20.5", record.Node.Attr["temperature"].Value)
+	assert.True(t, now.Equal(record.LastSeen))
+}
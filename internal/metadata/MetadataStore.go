@@ -0,0 +1,161 @@
+// Package metadata with user provided device metadata such as names and locations
+package metadata
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeviceMetadata with user provided information of a device
+// Empty fields are not set and use the information reported by the device.
+type DeviceMetadata struct {
+	// LogicalID is the device ID used in the Thing ID instead of the ROM ID.
+	// This keeps the Thing ID when a device is replaced.
+	LogicalID string `yaml:"logicalID,omitempty" json:"logicalID,omitempty"`
+	// Title is the friendly name of the device
+	Title string `yaml:"title,omitempty" json:"title,omitempty"`
+	// Description of the device
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Location or room of the device
+	Location string `yaml:"location,omitempty" json:"location,omitempty"`
+	// Tags to group devices
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+}
+
+// Merge returns the metadata with the non-empty fields of the override applied
+func (md DeviceMetadata) Merge(override DeviceMetadata) DeviceMetadata {
+	if override.LogicalID != "" {
+		md.LogicalID = override.LogicalID
+	}
+	if override.Title != "" {
+		md.Title = override.Title
+	}
+	if override.Description != "" {
+		md.Description = override.Description
+	}
+	if override.Location != "" {
+		md.Location = override.Location
+	}
+	if override.Tags != nil {
+		md.Tags = override.Tags
+	}
+	return md
+}
+
+// MetadataStore holds the metadata of devices by ROM ID
+// Metadata changed at runtime is persisted and overrides the configured metadata.
+type MetadataStore struct {
+	// file to persist metadata changed at runtime. "" to not persist.
+	filename string
+	// configured metadata by ROM ID
+	configured map[string]DeviceMetadata
+	// metadata changed at runtime by ROM ID
+	changed map[string]DeviceMetadata
+	mu      sync.RWMutex
+}
+
+// Get returns the metadata of a device
+// This returns empty metadata if none is set.
+func (ms *MetadataStore) Get(romID string) DeviceMetadata {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return ms.configured[romID].Merge(ms.changed[romID])
+}
+
+// Update the metadata of a device
+// Only the non-empty fields of the update are changed. Use Save to persist the change.
+func (ms *MetadataStore) Update(romID string, update DeviceMetadata) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.changed[romID] = ms.changed[romID].Merge(update)
+}
+
+// Move the metadata of a replaced device, including its logical ID, to its replacement
+// The old device keeps its title but is given its ROM ID as logical ID, so it no longer
+// shares the Thing ID with its replacement if it reappears.
+func (ms *MetadataStore) Move(oldRomID string, newRomID string) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	moved := ms.configured[oldRomID].Merge(ms.changed[oldRomID])
+	if moved.LogicalID == "" {
+		moved.LogicalID = oldRomID
+	}
+	ms.changed[newRomID] = ms.configured[newRomID].Merge(moved)
+	ms.changed[oldRomID] = DeviceMetadata{LogicalID: oldRomID}
+}
+
+// SetConfigured replaces the configured metadata
+// Metadata changed at runtime keeps overriding the configured metadata.
+//  configured with the configured metadata by ROM ID, nil for none
+func (ms *MetadataStore) SetConfigured(configured map[string]DeviceMetadata) {
+	if configured == nil {
+		configured = make(map[string]DeviceMetadata)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.configured = configured
+}
+
+// Load the persisted metadata, if persistence is enabled.
+// A missing file is not an error.
+func (ms *MetadataStore) Load() error {
+	if ms.filename == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(ms.filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		logrus.Errorf("Unable to read device metadata from '%s': %s", ms.filename, err)
+		return err
+	}
+	changed := make(map[string]DeviceMetadata)
+	err = json.Unmarshal(data, &changed)
+	if err != nil {
+		logrus.Errorf("Unable to parse device metadata file '%s': %s", ms.filename, err)
+		return err
+	}
+	ms.mu.Lock()
+	ms.changed = changed
+	ms.mu.Unlock()
+	return nil
+}
+
+// Save the metadata changed at runtime to file, if persistence is enabled.
+func (ms *MetadataStore) Save() error {
+	if ms.filename == "" {
+		return nil
+	}
+	ms.mu.RLock()
+	data, _ := json.MarshalIndent(ms.changed, "", "  ")
+	ms.mu.RUnlock()
+
+	tmpName := ms.filename + ".tmp"
+	err := ioutil.WriteFile(tmpName, data, 0600)
+	if err == nil {
+		err = os.Rename(tmpName, ms.filename)
+	}
+	if err != nil {
+		logrus.Errorf("Unable to save device metadata to '%s': %s", ms.filename, err)
+	}
+	return err
+}
+
+// NewMetadataStore creates a store with device metadata
+//  configured with the configured metadata by ROM ID, nil for none
+//  filename is the file to persist metadata changes in, "" to not persist
+func NewMetadataStore(configured map[string]DeviceMetadata, filename string) *MetadataStore {
+	if configured == nil {
+		configured = make(map[string]DeviceMetadata)
+	}
+	ms := &MetadataStore{
+		filename:   filename,
+		configured: configured,
+		changed:    make(map[string]DeviceMetadata),
+	}
+	return ms
+}
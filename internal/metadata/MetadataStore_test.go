@@ -0,0 +1,79 @@
+package metadata_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/metadata"
+)
+
+const testDevice = "2A000003BB170B28"
+
+func TestGetUpdate(t *testing.T) {
+	config := map[string]metadata.DeviceMetadata{
+		testDevice: {Title: "Boiler supply", Location: "Basement", Tags: []string{"heating"}},
+	}
+	ms := metadata.NewMetadataStore(config, "")
+	md := ms.Get(testDevice)
+	assert.Equal(t, "Boiler supply", md.Title)
+	assert.Equal(t, []string{"heating"}, md.Tags)
+
+	// only the location changes
+	ms.Update(testDevice, metadata.DeviceMetadata{Location: "Utility room"})
+	md = ms.Get(testDevice)
+	assert.Equal(t, "Boiler supply", md.Title)
+	assert.Equal(t, "Utility room", md.Location)
+
+	assert.Equal(t, "", ms.Get("unknown").Title)
+
+	// changed metadata keeps overriding the new configuration
+	ms.SetConfigured(map[string]metadata.DeviceMetadata{
+		testDevice: {Title: "Boiler return", Location: "Basement"},
+	})
+	md = ms.Get(testDevice)
+	assert.Equal(t, "Boiler return", md.Title)
+	assert.Equal(t, "Utility room", md.Location)
+	assert.Nil(t, md.Tags)
+}
+
+func TestMove(t *testing.T) {
+	const newDevice = "5B000003BB170B28"
+	config := map[string]metadata.DeviceMetadata{
+		testDevice: {Title: "Boiler supply", LogicalID: "boiler-supply"},
+	}
+	ms := metadata.NewMetadataStore(config, "")
+	ms.Move(testDevice, newDevice)
+	md := ms.Get(newDevice)
+	assert.Equal(t, "boiler-supply", md.LogicalID)
+	assert.Equal(t, "Boiler supply", md.Title)
+	assert.Equal(t, testDevice, ms.Get(testDevice).LogicalID)
+
+	// devices without logical ID keep the Thing ID of the old ROM ID
+	ms.Move("oldDevice", "otherDevice")
+	assert.Equal(t, "oldDevice", ms.Get("otherDevice").LogicalID)
+}
+
+func TestSaveLoad(t *testing.T) {
+	filename := path.Join(os.TempDir(), "owserver-metadata-test.json")
+	defer os.Remove(filename)
+
+	config := map[string]metadata.DeviceMetadata{
+		testDevice: {Title: "Boiler supply", Location: "Basement"},
+	}
+	ms := metadata.NewMetadataStore(config, filename)
+	ms.Update(testDevice, metadata.DeviceMetadata{Title: "Boiler return"})
+	err := ms.Save()
+	require.NoError(t, err)
+
+	// runtime changes override the configuration after a restart
+	ms2 := metadata.NewMetadataStore(config, filename)
+	err = ms2.Load()
+	require.NoError(t, err)
+	md := ms2.Get(testDevice)
+	assert.Equal(t, "Boiler return", md.Title)
+	assert.Equal(t, "Basement", md.Location)
+}
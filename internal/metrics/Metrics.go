@@ -0,0 +1,247 @@
+// Package metrics with health and performance metrics of the service
+package metrics
+
+import (
+	"encoding/xml"
+	"errors"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencySamples is the number of most recent poll latencies the percentiles are computed over
+const LatencySamples = 100
+
+// LatencyBuckets are the upper bounds in seconds of the poll latency histogram buckets
+var LatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// Types of poll errors
+const (
+	ErrorTypeTimeout    = "timeout"
+	ErrorTypeConnection = "connection"
+	ErrorTypeParse      = "parse"
+	ErrorTypeOther      = "other"
+)
+
+// ErrorType returns the type of a poll error: timeout, connection, parse or other
+func ErrorType(err error) string {
+	var netErr net.Error
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTypeTimeout
+	} else if netErr != nil || errors.Is(err, os.ErrNotExist) {
+		return ErrorTypeConnection
+	} else if errors.As(err, &syntaxErr) {
+		return ErrorTypeParse
+	}
+	return ErrorTypeOther
+}
+
+// MetricsSnapshot holds the metrics at a point in time
+type MetricsSnapshot struct {
+	// PollSuccessCount is the number of successful polls of the gateway
+	PollSuccessCount int
+	// PollFailureCount is the number of failed polls of the gateway
+	PollFailureCount int
+	// LatencyP50, P90 and P99 are the percentiles of the recent poll latencies in milliseconds
+	LatencyP50 float64
+	LatencyP90 float64
+	LatencyP99 float64
+	// LatencyBucketCounts are the cumulative number of polls with a latency up to each of
+	// the LatencyBuckets
+	LatencyBucketCounts []int
+	// LatencySum is the sum of all poll latencies in seconds
+	LatencySum float64
+	// PollErrors is the number of failed polls by error type
+	PollErrors map[string]int
+	// GatewayUp is true if the last poll of the gateway succeeded
+	GatewayUp bool
+	// LastPollTime is the time of the last successful poll, zero if none
+	LastPollTime time.Time
+	// ThingsExposed is the number of exposed Things
+	ThingsExposed int
+	// MessagesPerMinute is the number of messages published over the last minute
+	MessagesPerMinute int
+	// MessagesTotal is the number of messages published since the start
+	MessagesTotal int
+	// BusUp is true unless the last publication on the message bus failed
+	BusUp bool
+	// WriteSuccessCount is the number of successful writes to devices
+	WriteSuccessCount int
+	// WriteFailureCount is the number of rejected or failed writes to devices
+	WriteFailureCount int
+	// Uptime is the time since the start
+	Uptime time.Duration
+}
+
+// Metrics collects the health and performance metrics of the service
+type Metrics struct {
+	startTime         time.Time
+	pollSuccessCount  int
+	pollFailureCount  int
+	lastPollTime      time.Time
+	latencies         []time.Duration // ring buffer with the most recent latencies
+	latencyIndex      int
+	bucketCounts      []int // non-cumulative count of latencies per bucket
+	latencySum        float64
+	pollErrors        map[string]int
+	gatewayUp         bool
+	thingsExposed     int
+	messageTimes      []time.Time // publication times within the last minute
+	messagesTotal     int
+	busUp             bool
+	writeSuccessCount int
+	writeFailureCount int
+	mu                sync.Mutex
+}
+
+// RecordPoll records the result of a poll of the gateway
+//  latency is the time it took to read the gateway
+//  timestamp is the time of the poll
+//  err is the error if the poll failed, nil on success
+func (m *Metrics) RecordPoll(latency time.Duration, timestamp time.Time, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.pollFailureCount++
+		m.pollErrors[ErrorType(err)]++
+		m.gatewayUp = false
+		return
+	}
+	m.pollSuccessCount++
+	m.lastPollTime = timestamp
+	m.gatewayUp = true
+	m.latencySum += latency.Seconds()
+	for i, upperBound := range LatencyBuckets {
+		if latency.Seconds() <= upperBound {
+			m.bucketCounts[i]++
+			break
+		}
+	}
+	if len(m.latencies) < LatencySamples {
+		m.latencies = append(m.latencies, latency)
+	} else {
+		m.latencies[m.latencyIndex] = latency
+		m.latencyIndex = (m.latencyIndex + 1) % LatencySamples
+	}
+}
+
+// RecordMessages records the publication of messages
+//  count is the number of published messages
+//  timestamp is the time of publication
+func (m *Metrics) RecordMessages(count int, timestamp time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < count; i++ {
+		m.messageTimes = append(m.messageTimes, timestamp)
+	}
+	m.messagesTotal += count
+	m.busUp = true
+	m.pruneMessages(timestamp)
+}
+
+// RecordPublishFailure records a failed publication on the message bus
+// The bus is considered down until the next successful publication.
+func (m *Metrics) RecordPublishFailure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.busUp = false
+}
+
+// RecordWrite records the result of a write to a device
+//  err is the error if the write was rejected or failed, nil on success
+func (m *Metrics) RecordWrite(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.writeFailureCount++
+	} else {
+		m.writeSuccessCount++
+	}
+}
+
+// SetThingsExposed sets the number of exposed Things
+func (m *Metrics) SetThingsExposed(count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.thingsExposed = count
+}
+
+// pruneMessages removes publication times older than a minute
+func (m *Metrics) pruneMessages(now time.Time) {
+	minuteAgo := now.Add(-time.Minute)
+	i := sort.Search(len(m.messageTimes), func(i int) bool {
+		return m.messageTimes[i].After(minuteAgo)
+	})
+	m.messageTimes = m.messageTimes[i:]
+}
+
+// percentile returns the p-th percentile, 0-100, of sorted latencies in milliseconds
+// using the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return float64(sorted[rank].Microseconds()) / 1000
+}
+
+// GetSnapshot returns the metrics at the given time
+func (m *Metrics) GetSnapshot(now time.Time) MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneMessages(now)
+	sorted := make([]time.Duration, len(m.latencies))
+	copy(sorted, m.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	bucketCounts := make([]int, len(m.bucketCounts))
+	cumulative := 0
+	for i, count := range m.bucketCounts {
+		cumulative += count
+		bucketCounts[i] = cumulative
+	}
+	pollErrors := make(map[string]int, len(m.pollErrors))
+	for errorType, count := range m.pollErrors {
+		pollErrors[errorType] = count
+	}
+
+	return MetricsSnapshot{
+		PollSuccessCount:    m.pollSuccessCount,
+		PollFailureCount:    m.pollFailureCount,
+		LatencyP50:          percentile(sorted, 50),
+		LatencyP90:          percentile(sorted, 90),
+		LatencyP99:          percentile(sorted, 99),
+		LatencyBucketCounts: bucketCounts,
+		LatencySum:          m.latencySum,
+		PollErrors:          pollErrors,
+		GatewayUp:           m.gatewayUp,
+		LastPollTime:        m.lastPollTime,
+		ThingsExposed:       m.thingsExposed,
+		MessagesPerMinute:   len(m.messageTimes),
+		MessagesTotal:       m.messagesTotal,
+		BusUp:               m.busUp,
+		WriteSuccessCount:   m.writeSuccessCount,
+		WriteFailureCount:   m.writeFailureCount,
+		Uptime:              now.Sub(m.startTime),
+	}
+}
+
+// NewMetrics creates a new metrics collector
+//  startTime is the time the service started, used for the uptime
+func NewMetrics(startTime time.Time) *Metrics {
+	m := &Metrics{
+		startTime:    startTime,
+		latencies:    make([]time.Duration, 0, LatencySamples),
+		bucketCounts: make([]int, len(LatencyBuckets)),
+		pollErrors:   make(map[string]int),
+		messageTimes: make([]time.Time, 0),
+		busUp:        true,
+	}
+	return m
+}
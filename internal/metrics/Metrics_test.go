@@ -0,0 +1,96 @@
+package metrics_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/metrics"
+)
+
+func TestPolls(t *testing.T) {
+	start := time.Now()
+	m := metrics.NewMetrics(start)
+	snapshot := m.GetSnapshot(start)
+	assert.Equal(t, 0, snapshot.PollSuccessCount)
+	assert.Equal(t, 0.0, snapshot.LatencyP99)
+	assert.True(t, snapshot.LastPollTime.IsZero())
+
+	for i := 1; i <= 100; i++ {
+		m.RecordPoll(time.Duration(i)*time.Millisecond, start.Add(time.Duration(i)*time.Second), nil)
+	}
+	m.RecordPoll(time.Second, start, errors.New("timeout"))
+
+	snapshot = m.GetSnapshot(start.Add(time.Hour))
+	assert.Equal(t, 100, snapshot.PollSuccessCount)
+	assert.Equal(t, 1, snapshot.PollFailureCount)
+	assert.Equal(t, 50.0, snapshot.LatencyP50)
+	assert.Equal(t, 90.0, snapshot.LatencyP90)
+	assert.Equal(t, 99.0, snapshot.LatencyP99)
+	assert.Equal(t, start.Add(100*time.Second), snapshot.LastPollTime)
+	assert.Equal(t, time.Hour, snapshot.Uptime)
+
+	// only the most recent latencies are kept
+	for i := 0; i < metrics.LatencySamples; i++ {
+		m.RecordPoll(5*time.Millisecond, start, nil)
+	}
+	snapshot = m.GetSnapshot(start)
+	assert.Equal(t, 5.0, snapshot.LatencyP99)
+}
+
+func TestMessagesAndWrites(t *testing.T) {
+	start := time.Now()
+	m := metrics.NewMetrics(start)
+	m.RecordMessages(3, start)
+	m.RecordMessages(2, start.Add(30*time.Second))
+	m.RecordWrite(nil)
+	m.RecordWrite(errors.New("rejected"))
+	m.SetThingsExposed(4)
+
+	snapshot := m.GetSnapshot(start.Add(45 * time.Second))
+	assert.Equal(t, 5, snapshot.MessagesPerMinute)
+	assert.Equal(t, 5, snapshot.MessagesTotal)
+	assert.Equal(t, 1, snapshot.WriteSuccessCount)
+	assert.Equal(t, 1, snapshot.WriteFailureCount)
+	assert.Equal(t, 4, snapshot.ThingsExposed)
+
+	// messages older than a minute are not counted
+	snapshot = m.GetSnapshot(start.Add(75 * time.Second))
+	assert.Equal(t, 2, snapshot.MessagesPerMinute)
+	assert.Equal(t, 5, snapshot.MessagesTotal)
+
+	// the bus is down until the next successful publication
+	assert.True(t, snapshot.BusUp)
+	m.RecordPublishFailure()
+	assert.False(t, m.GetSnapshot(start).BusUp)
+	m.RecordMessages(1, start)
+	assert.True(t, m.GetSnapshot(start).BusUp)
+}
+
+func TestHistogramAndErrors(t *testing.T) {
+	start := time.Now()
+	m := metrics.NewMetrics(start)
+	m.RecordPoll(30*time.Millisecond, start, nil)
+	m.RecordPoll(200*time.Millisecond, start, nil)
+	m.RecordPoll(10*time.Second, start, nil)
+	m.RecordPoll(0, start, &net.DNSError{Err: "timeout", IsTimeout: true})
+	m.RecordPoll(0, start, &net.OpError{Op: "dial", Err: errors.New("connection refused")})
+	m.RecordPoll(0, start, &xml.SyntaxError{Msg: "unexpected EOF"})
+
+	snapshot := m.GetSnapshot(start)
+	assert.Equal(t, len(metrics.LatencyBuckets), len(snapshot.LatencyBucketCounts))
+	// 30ms falls in the 0.05 bucket, 200ms in the 0.25 bucket and 10s in none
+	assert.Equal(t, []int{1, 1, 2, 2, 2, 2, 2}, snapshot.LatencyBucketCounts)
+	assert.InDelta(t, 10.23, snapshot.LatencySum, 0.0001)
+	assert.Equal(t, map[string]int{metrics.ErrorTypeTimeout: 1, metrics.ErrorTypeConnection: 1,
+		metrics.ErrorTypeParse: 1}, snapshot.PollErrors)
+	assert.False(t, snapshot.GatewayUp)
+
+	m.RecordPoll(time.Millisecond, start, nil)
+	assert.True(t, m.GetSnapshot(start).GatewayUp)
+	assert.Equal(t, metrics.ErrorTypeOther, metrics.ErrorType(errors.New("unknown")))
+}
@@ -0,0 +1,301 @@
+// Package mqttfactory exposes Things on an MQTT broker with its own connection settings
+// This is used in standalone mode, when the service does not run as a plugin of the hub.
+package mqttfactory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/sirupsen/logrus"
+	"github.com/wostzone/wost-go/pkg/consumedthing"
+	"github.com/wostzone/wost-go/pkg/exposedthing"
+	"github.com/wostzone/wost-go/pkg/thing"
+)
+
+// Default broker ports
+const (
+	DefaultTCPPort = 1883
+	DefaultTLSPort = 8883
+)
+
+// Timeouts of the broker connection
+const (
+	ConnectTimeout = 10 * time.Second
+	PublishTimeout = 10 * time.Second
+	KeepAlive      = 10 * time.Second
+)
+
+// Config of the connection to the MQTT broker
+type Config struct {
+	// BrokerURL of the MQTT broker, eg "tls://broker.local:8883", or "tcp://broker.local:1883"
+	// to connect without TLS for lab use. Standalone mode is enabled if set.
+	BrokerURL string `yaml:"brokerURL,omitempty"`
+	// CACertFile is the PEM file with the CA certificate to verify the broker. Default uses the
+	// system CA certificates.
+	CACertFile string `yaml:"caCertFile,omitempty"`
+	// ClientCertFile and ClientKeyFile are the PEM files with the client certificate and key
+	// to authenticate with. Default is none.
+	ClientCertFile string `yaml:"clientCertFile,omitempty"`
+	ClientKeyFile  string `yaml:"clientKeyFile,omitempty"`
+	// Username and Password to authenticate with. Default is none.
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// PasswordFile is the file to read the password from instead of the password setting
+	PasswordFile string `yaml:"passwordFile,omitempty"`
+}
+
+// ParseBrokerURL returns the host, port and whether TLS is used for a broker URL
+// Supported schemes are tcp and mqtt without TLS, and tls, ssl and mqtts with TLS.
+func ParseBrokerURL(brokerURL string) (host string, port int, useTLS bool, err error) {
+	u, err := url.Parse(brokerURL)
+	if err != nil {
+		return "", 0, false, err
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		useTLS, port = false, DefaultTCPPort
+	case "tls", "ssl", "mqtts":
+		useTLS, port = true, DefaultTLSPort
+	default:
+		return "", 0, false, fmt.Errorf("broker URL '%s' must start with tcp://, mqtt://, tls://, ssl:// or mqtts://", brokerURL)
+	}
+	host = u.Hostname()
+	if host == "" {
+		return "", 0, false, fmt.Errorf("broker URL '%s' has no host", brokerURL)
+	}
+	if u.Port() != "" {
+		_, err = fmt.Sscanf(u.Port(), "%d", &port)
+		if err != nil || port <= 0 || port > 65535 {
+			return "", 0, false, fmt.Errorf("broker URL '%s' has an invalid port", brokerURL)
+		}
+	}
+	return host, port, useTLS, nil
+}
+
+// MqttFactory exposes Things on an MQTT broker
+// Things are published with the same topics as the hub message bus.
+type MqttFactory struct {
+	// clientID is used in the MQTT client ID
+	clientID string
+	// config with the broker URL and authentication
+	config Config
+	// useTLS is set when the broker URL uses TLS
+	useTLS bool
+	// pahoClient is the broker connection, nil when not connected
+	pahoClient pahomqtt.Client
+	// exposed things by Thing ID
+	eThings map[string]*exposedthing.ExposedThing
+	mu      sync.Mutex
+}
+
+// newTLSConfig creates the TLS configuration with the CA and client certificates
+func (factory *MqttFactory) newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if factory.config.CACertFile != "" {
+		caPEM, err := ioutil.ReadFile(factory.config.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no CA certificate found in '%s'", factory.config.CACertFile)
+		}
+	}
+	if factory.config.ClientCertFile != "" {
+		clientCert, err := tls.LoadX509KeyPair(factory.config.ClientCertFile, factory.config.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	}
+	return tlsConfig, nil
+}
+
+// Connect to the MQTT broker
+// This keeps reconnecting in the background if the connection is lost after it is established.
+//  address of the broker, eg from ParseBrokerURL
+//  port of the broker
+func (factory *MqttFactory) Connect(address string, port int) error {
+	scheme := "tcp"
+	opts := pahomqtt.NewClientOptions()
+	if factory.useTLS {
+		scheme = "tls"
+		tlsConfig, err := factory.newTLSConfig()
+		if err != nil {
+			logrus.Errorf("Unable to load the certificates for broker '%s': %s", factory.config.BrokerURL, err)
+			return err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	} else if factory.config.Password != "" {
+		logrus.Warningf("Broker '%s' is not using TLS. The password is sent unencrypted.", factory.config.BrokerURL)
+	}
+	brokerURL := fmt.Sprintf("%s://%s:%d", scheme, address, port)
+	hostName, _ := os.Hostname()
+	opts.AddBroker(brokerURL)
+	opts.SetClientID(fmt.Sprintf("%s-%s-%d", factory.clientID, hostName, time.Now().UnixMilli()))
+	opts.SetUsername(factory.config.Username)
+	opts.SetPassword(factory.config.Password)
+	opts.SetCleanSession(true)
+	opts.SetAutoReconnect(true)
+	opts.SetConnectTimeout(ConnectTimeout)
+	opts.SetKeepAlive(KeepAlive)
+	opts.SetMaxReconnectInterval(time.Minute)
+	opts.SetOnConnectHandler(func(client pahomqtt.Client) {
+		logrus.Warningf("Connected to broker at %s", brokerURL)
+		factory.resubscribe()
+	})
+	opts.SetConnectionLostHandler(func(client pahomqtt.Client, err error) {
+		logrus.Warningf("Connection to broker at %s lost: %s", brokerURL, err)
+	})
+
+	pahoClient := pahomqtt.NewClient(opts)
+	factory.mu.Lock()
+	factory.pahoClient = pahoClient
+	factory.mu.Unlock()
+	logrus.Infof("Connecting to broker at %s as user '%s', with client certificate: %v",
+		brokerURL, factory.config.Username, factory.config.ClientCertFile != "")
+	token := pahoClient.Connect()
+	if !token.WaitTimeout(ConnectTimeout) {
+		return fmt.Errorf("connecting to broker at %s timed out", brokerURL)
+	}
+	if token.Error() != nil {
+		logrus.Errorf("Unable to connect to broker at %s: %s", brokerURL, token.Error())
+	}
+	return token.Error()
+}
+
+// Disconnect from the MQTT broker
+func (factory *MqttFactory) Disconnect() {
+	factory.mu.Lock()
+	pahoClient := factory.pahoClient
+	factory.pahoClient = nil
+	factory.mu.Unlock()
+	if pahoClient != nil {
+		pahoClient.Disconnect(uint(time.Second.Milliseconds()))
+	}
+}
+
+// IsConnected returns true while connected to the MQTT broker
+func (factory *MqttFactory) IsConnected() bool {
+	factory.mu.Lock()
+	pahoClient := factory.pahoClient
+	factory.mu.Unlock()
+	return pahoClient != nil && pahoClient.IsConnected()
+}
+
+// publish a JSON encoded object to a topic
+func (factory *MqttFactory) publish(topic string, object interface{}) error {
+	factory.mu.Lock()
+	pahoClient := factory.pahoClient
+	factory.mu.Unlock()
+	if pahoClient == nil || !pahoClient.IsConnected() {
+		return errors.New("no connection with broker")
+	}
+	payload, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	token := pahoClient.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(PublishTimeout) {
+		return fmt.Errorf("publishing on '%s' timed out", topic)
+	}
+	return token.Error()
+}
+
+// subscribe to the action requests of an exposed thing
+func (factory *MqttFactory) subscribe(pahoClient pahomqtt.Client, eThing *exposedthing.ExposedThing) {
+	topic := strings.ReplaceAll(consumedthing.TopicInvokeAction, "{thingID}", eThing.TD.ID) + "/#"
+	pahoClient.Subscribe(topic, 1, func(client pahomqtt.Client, msg pahomqtt.Message) {
+		// the topic is things/{thingID}/action/{actionName}
+		_, _, actionName := consumedthing.SplitTopic(msg.Topic())
+		if actionName == "" {
+			logrus.Warningf("Action name is missing in topic '%s'", msg.Topic())
+			return
+		}
+		eThing.HandleActionRequest(actionName, msg.Payload())
+	})
+}
+
+// resubscribe to the action requests of all exposed things after (re)connecting
+func (factory *MqttFactory) resubscribe() {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	if factory.pahoClient == nil {
+		return
+	}
+	for _, eThing := range factory.eThings {
+		factory.subscribe(factory.pahoClient, eThing)
+	}
+}
+
+// Expose creates an exposed thing, subscribes to its action requests and publishes its TD
+// This returns the existing exposed thing and true if a Thing with the same ID is already exposed.
+//  deviceID is the internal ID of the device
+//  td is the Thing Description document of the Thing
+func (factory *MqttFactory) Expose(deviceID string, td *thing.ThingTD) (*exposedthing.ExposedThing, bool) {
+	factory.mu.Lock()
+	eThing, found := factory.eThings[td.ID]
+	if found {
+		factory.mu.Unlock()
+		return eThing, true
+	}
+	eThing = exposedthing.CreateExposedThing(deviceID, td)
+	eThing.EmitEventHook = func(name string, data interface{}) error {
+		topic := strings.ReplaceAll(consumedthing.TopicEmitEvent, "{thingID}", td.ID) + "/" + name
+		return factory.publish(topic, data)
+	}
+	eThing.EmitPropertiesChangeHook = func(props map[string]interface{}) error {
+		topic := strings.ReplaceAll(consumedthing.TopicEmitPropertiesChange, "{thingID}", td.ID)
+		return factory.publish(topic, props)
+	}
+	factory.eThings[td.ID] = eThing
+	pahoClient := factory.pahoClient
+	if pahoClient != nil {
+		factory.subscribe(pahoClient, eThing)
+	}
+	factory.mu.Unlock()
+
+	topic := strings.ReplaceAll(consumedthing.TopicThingTD, "{thingID}", td.ID)
+	err := factory.publish(topic, td)
+	if err != nil {
+		logrus.Warningf("Unable to publish the TD of '%s': %s", td.ID, err)
+	}
+	return eThing, false
+}
+
+// Destroy stops serving the action requests of an exposed thing and removes it
+func (factory *MqttFactory) Destroy(eThing *exposedthing.ExposedThing) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	if factory.pahoClient != nil {
+		topic := strings.ReplaceAll(consumedthing.TopicInvokeAction, "{thingID}", eThing.TD.ID) + "/#"
+		factory.pahoClient.Unsubscribe(topic)
+	}
+	eThing.Destroy()
+	delete(factory.eThings, eThing.TD.ID)
+}
+
+// NewMqttFactory creates a factory that exposes Things on the configured MQTT broker
+// The broker URL must be valid, see ParseBrokerURL.
+//  clientID of the service, used in the MQTT client ID
+//  config with the broker URL and authentication
+func NewMqttFactory(clientID string, config Config) *MqttFactory {
+	_, _, useTLS, _ := ParseBrokerURL(config.BrokerURL)
+	factory := &MqttFactory{
+		clientID: clientID,
+		config:   config,
+		useTLS:   useTLS,
+		eThings:  make(map[string]*exposedthing.ExposedThing),
+	}
+	return factory
+}
@@ -0,0 +1,69 @@
+package mqttfactory_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+
+	"github.com/wostzone/owserver/internal/mqttfactory"
+)
+
+func TestParseBrokerURL(t *testing.T) {
+	host, port, useTLS, err := mqttfactory.ParseBrokerURL("tls://broker.local")
+	require.NoError(t, err)
+	assert.Equal(t, "broker.local", host)
+	assert.Equal(t, mqttfactory.DefaultTLSPort, port)
+	assert.True(t, useTLS)
+
+	host, port, useTLS, err = mqttfactory.ParseBrokerURL("tcp://192.168.1.10:1884")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.1.10", host)
+	assert.Equal(t, 1884, port)
+	assert.False(t, useTLS)
+
+	_, _, _, err = mqttfactory.ParseBrokerURL("ws://broker.local")
+	assert.Error(t, err)
+	_, _, _, err = mqttfactory.ParseBrokerURL("tcp://:1883")
+	assert.Error(t, err)
+	_, _, _, err = mqttfactory.ParseBrokerURL("tcp://broker.local:99999")
+	assert.Error(t, err)
+}
+
+func TestExposeWithoutConnection(t *testing.T) {
+	factory := mqttfactory.NewMqttFactory("owserver", mqttfactory.Config{BrokerURL: "tcp://127.0.0.1:1"})
+	td := thing.CreateTD("local:owserver:device1", "Device 1", vocab.DeviceTypeSensor)
+
+	assert.False(t, factory.IsConnected())
+	eThing, found := factory.Expose("device1", td)
+	require.NotNil(t, eThing)
+	assert.False(t, found)
+	err := eThing.EmitEventHook("alarm", "on")
+	assert.Error(t, err, "publishing requires a connection")
+	err = eThing.EmitPropertiesChangeHook(map[string]interface{}{"temperature": 21.5})
+	assert.Error(t, err)
+
+	eThing2, found := factory.Expose("device1", td)
+	assert.True(t, found)
+	assert.Same(t, eThing, eThing2)
+
+	factory.Destroy(eThing)
+	_, found = factory.Expose("device1", td)
+	assert.False(t, found)
+}
+
+func TestConnectFails(t *testing.T) {
+	factory := mqttfactory.NewMqttFactory("owserver", mqttfactory.Config{BrokerURL: "tcp://127.0.0.1:1"})
+	err := factory.Connect("127.0.0.1", 1)
+	assert.Error(t, err)
+	factory.Disconnect()
+
+	factory = mqttfactory.NewMqttFactory("owserver", mqttfactory.Config{
+		BrokerURL:  "tls://127.0.0.1:1",
+		CACertFile: "/notafolder/ca.pem",
+	})
+	err = factory.Connect("127.0.0.1", 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+// Package openmetrics writes metrics in the Prometheus text exposition format
+package openmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Metric types
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// Label of a metric sample as a name-value pair, eg {"result", "success"}
+type Label [2]string
+
+// Exposition collects metric families in the text exposition format
+type Exposition struct {
+	buf bytes.Buffer
+}
+
+// AddFamily starts a metric family with its help text and type
+// The samples of the family must be added directly after.
+func (e *Exposition) AddFamily(name string, help string, metricType string) {
+	help = strings.ReplaceAll(help, `\`, `\\`)
+	help = strings.ReplaceAll(help, "\n", `\n`)
+	fmt.Fprintf(&e.buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(&e.buf, "# TYPE %s %s\n", name, metricType)
+}
+
+// AddSample adds a sample with optional labels
+func (e *Exposition) AddSample(name string, labels []Label, value float64) {
+	e.buf.WriteString(name)
+	if len(labels) > 0 {
+		e.buf.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&e.buf, `%s="%s"`, label[0], EscapeLabelValue(label[1]))
+		}
+		e.buf.WriteByte('}')
+	}
+	e.buf.WriteByte(' ')
+	e.buf.WriteString(FormatValue(value))
+	e.buf.WriteByte('\n')
+}
+
+// AddHistogram adds a histogram family with its buckets, sum and count
+//  bounds are the upper bounds of the buckets
+//  cumulativeCounts are the number of observations up to each bound
+//  sum is the sum of all observations
+//  count is the total number of observations, including those above the last bound
+func (e *Exposition) AddHistogram(name string, help string,
+	bounds []float64, cumulativeCounts []int, sum float64, count int) {
+
+	e.AddFamily(name, help, TypeHistogram)
+	for i, bound := range bounds {
+		e.AddSample(name+"_bucket", []Label{{"le", FormatValue(bound)}}, float64(cumulativeCounts[i]))
+	}
+	e.AddSample(name+"_bucket", []Label{{"le", "+Inf"}}, float64(count))
+	e.AddSample(name+"_sum", nil, sum)
+	e.AddSample(name+"_count", nil, float64(count))
+}
+
+// Bytes returns the exposition text
+func (e *Exposition) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// EscapeLabelValue escapes backslashes, double quotes and newlines in a label value
+func EscapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// FormatValue formats a sample value
+func FormatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
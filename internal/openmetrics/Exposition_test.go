@@ -0,0 +1,48 @@
+package openmetrics_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/openmetrics"
+)
+
+func TestExposition(t *testing.T) {
+	e := openmetrics.Exposition{}
+	e.AddFamily("owserver_polls_total", "Number of polls", openmetrics.TypeCounter)
+	e.AddSample("owserver_polls_total", []openmetrics.Label{{"result", "success"}}, 10)
+	e.AddSample("owserver_polls_total", []openmetrics.Label{{"result", "failure"}}, 2)
+	e.AddFamily("owserver_up", "Gateway state", openmetrics.TypeGauge)
+	e.AddSample("owserver_up", nil, 1)
+
+	expected := "# HELP owserver_polls_total Number of polls\n" +
+		"# TYPE owserver_polls_total counter\n" +
+		"owserver_polls_total{result=\"success\"} 10\n" +
+		"owserver_polls_total{result=\"failure\"} 2\n" +
+		"# HELP owserver_up Gateway state\n" +
+		"# TYPE owserver_up gauge\n" +
+		"owserver_up 1\n"
+	assert.Equal(t, expected, string(e.Bytes()))
+}
+
+func TestHistogram(t *testing.T) {
+	e := openmetrics.Exposition{}
+	e.AddHistogram("latency_seconds", "Latency", []float64{0.1, 1}, []int{1, 3}, 2.5, 4)
+	expected := "# HELP latency_seconds Latency\n" +
+		"# TYPE latency_seconds histogram\n" +
+		"latency_seconds_bucket{le=\"0.1\"} 1\n" +
+		"latency_seconds_bucket{le=\"1\"} 3\n" +
+		"latency_seconds_bucket{le=\"+Inf\"} 4\n" +
+		"latency_seconds_sum 2.5\n" +
+		"latency_seconds_count 4\n"
+	assert.Equal(t, expected, string(e.Bytes()))
+}
+
+func TestEscaping(t *testing.T) {
+	assert.Equal(t, `a \"quoted\" \\ value\n`, openmetrics.EscapeLabelValue("a \"quoted\" \\ value\n"))
+	assert.Equal(t, "+Inf", openmetrics.FormatValue(math.Inf(1)))
+	assert.Equal(t, "NaN", openmetrics.FormatValue(math.NaN()))
+	assert.Equal(t, "20.5", openmetrics.FormatValue(20.5))
+}
@@ -0,0 +1,78 @@
+// Package redact removes secrets such as passwords from log messages
+package redact
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Replacement of secrets in log messages
+const Replacement = "*****"
+
+// Hook is a logrus hook that replaces secrets in the message and fields of log entries
+type Hook struct {
+	secrets map[string]bool
+	mu      sync.RWMutex
+}
+
+// AddSecret adds a value that must not appear in the log. Empty values are ignored.
+func (hook *Hook) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	hook.secrets[secret] = true
+}
+
+// Levels returns the log levels the hook applies to, which are all levels
+func (hook *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire replaces the secrets in the log entry before it is written
+func (hook *Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = hook.Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = hook.Redact(v)
+		case error:
+			entry.Data[key] = hook.Redact(v.Error())
+		}
+	}
+	return nil
+}
+
+// Redact returns the text with the secrets replaced
+func (hook *Hook) Redact(text string) string {
+	hook.mu.RLock()
+	defer hook.mu.RUnlock()
+	for secret := range hook.secrets {
+		text = strings.ReplaceAll(text, secret, Replacement)
+	}
+	return text
+}
+
+// NewHook creates a hook without secrets
+func NewHook() *Hook {
+	return &Hook{secrets: make(map[string]bool)}
+}
+
+// standardHook is the hook installed in the standard logger
+var standardHook *Hook
+var standardHookMutex sync.Mutex
+
+// AddSecret adds a value that must not appear in the log of the standard logger
+// This installs the redacting hook in the standard logger the first time it is used.
+func AddSecret(secret string) {
+	standardHookMutex.Lock()
+	if standardHook == nil {
+		standardHook = NewHook()
+		logrus.AddHook(standardHook)
+	}
+	standardHookMutex.Unlock()
+	standardHook.AddSecret(secret)
+}
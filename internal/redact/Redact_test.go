@@ -0,0 +1,36 @@
+package redact_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/redact"
+)
+
+func TestRedact(t *testing.T) {
+	hook := redact.NewHook()
+	hook.AddSecret("")
+	assert.Equal(t, "nothing to hide", hook.Redact("nothing to hide"))
+
+	hook.AddSecret("s3cret")
+	assert.Equal(t, "login with *****", hook.Redact("login with s3cret"))
+}
+
+func TestHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	hook := redact.NewHook()
+	hook.AddSecret("s3cret")
+	logger.AddHook(hook)
+
+	logger.WithField("password", "s3cret").
+		WithError(errors.New("login s3cret rejected")).
+		Errorf("Unable to login with password '%s'", "s3cret")
+	assert.NotContains(t, buf.String(), "s3cret")
+	assert.Contains(t, buf.String(), redact.Replacement)
+}
@@ -0,0 +1,55 @@
+// Package sdnotify sends service state notifications to systemd
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Service states
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notify sends a state notification to systemd over the socket in the NOTIFY_SOCKET
+// environment variable.
+// This returns false without error if the service is not started by systemd with notification
+// support, eg when Type=notify is not set in the unit.
+//  state is the notification, eg READY=1
+func Notify(state string) (sent bool, err error) {
+	socketName := os.Getenv("NOTIFY_SOCKET")
+	if socketName == "" {
+		return false, nil
+	}
+	// abstract sockets start with '@'
+	if socketName[0] == '@' {
+		socketName = "\x00" + socketName[1:]
+	}
+	socketAddr := &net.UnixAddr{Name: socketName, Net: "unixgram"}
+	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err == nil, err
+}
+
+// WatchdogInterval returns the interval at which systemd expects watchdog notifications.
+// This is half the watchdog timeout from the WATCHDOG_USEC environment variable, or 0 if
+// the watchdog is not enabled for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	watchdogPID := os.Getenv("WATCHDOG_PID")
+	if watchdogPID != "" && watchdogPID != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
@@ -0,0 +1,63 @@
+package sdnotify_test
+
+import (
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/sdnotify"
+)
+
+func TestNotify(t *testing.T) {
+	socketName := path.Join(os.TempDir(), "owserver-sdnotify-test.sock")
+	_ = os.Remove(socketName)
+	defer os.Remove(socketName)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socketName, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socketName)
+	sent, err := sdnotify.Notify(sdnotify.StateReady)
+	require.NoError(t, err)
+	assert.True(t, sent)
+
+	buf := make([]byte, 64)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, sdnotify.StateReady, string(buf[:n]))
+}
+
+func TestNotifyDisabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := sdnotify.Notify(sdnotify.StateReady)
+	assert.NoError(t, err)
+	assert.False(t, sent)
+
+	t.Setenv("NOTIFY_SOCKET", path.Join(os.TempDir(), "owserver-sdnotify-missing.sock"))
+	sent, err = sdnotify.Notify(sdnotify.StateReady)
+	assert.Error(t, err)
+	assert.False(t, sent)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Equal(t, time.Duration(0), sdnotify.WatchdogInterval())
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "")
+	assert.Equal(t, 15*time.Second, sdnotify.WatchdogInterval())
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	assert.Equal(t, 15*time.Second, sdnotify.WatchdogInterval())
+
+	// the watchdog is meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Equal(t, time.Duration(0), sdnotify.WatchdogInterval())
+}
@@ -0,0 +1,212 @@
+// Package stats with statistics of sensor values over time windows
+package stats
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WindowToday is the name of the window that starts at midnight
+const WindowToday = "today"
+
+// Window is a time window over which statistics are collected.
+// Windows are aligned to midnight in the configured timezone. A window of 1 hour
+// runs from the start of each hour. 'today' and windows of a whole number of days run
+// from midnight as calendar days, so they last 23 or 25 hours on a daylight saving
+// transition. Windows of 7 days start on Monday. Other windows longer than 24 hours, eg
+// 36h, are aligned to multiples of their duration since the Unix epoch.
+// Statistics are reset at the start of each window.
+type Window struct {
+	// Name of the window, used in the name of the statistics properties
+	Name string
+	// Duration of the window
+	Duration time.Duration
+}
+
+// day is the duration of a calendar day without daylight saving transition
+const day = 24 * time.Hour
+
+// referenceMonday is the first day of the calendar day windows, so weekly windows start on Monday
+var referenceMonday = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// unixEpoch is the start of the windows longer than a day that are not whole days
+var unixEpoch = time.Unix(0, 0)
+
+// StartOf returns the start of the window that contains the given time
+func (w Window) StartOf(t time.Time, location *time.Location) time.Time {
+	t = t.In(location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+	if w.Name == WindowToday || w.Duration%day == 0 {
+		// count calendar days in UTC, which has no daylight saving transitions
+		date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(date.Sub(referenceMonday) / day)
+		windowDays := int(w.Duration / day)
+		offset := ((days % windowDays) + windowDays) % windowDays
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, location)
+	} else if w.Duration > day {
+		elapsed := t.Sub(unixEpoch)
+		return t.Add(-(elapsed % w.Duration))
+	}
+	elapsed := t.Sub(midnight)
+	return midnight.Add(elapsed - elapsed%w.Duration)
+}
+
+// ParseWindow parses a window name into a window.
+// Valid names are 'today' or a duration such as '15m', '1h' or '24h'.
+func ParseWindow(name string) (Window, error) {
+	if name == WindowToday {
+		return Window{Name: name, Duration: 24 * time.Hour}, nil
+	}
+	duration, err := time.ParseDuration(name)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid statistics window '%s': %s", name, err)
+	} else if duration <= 0 {
+		return Window{}, fmt.Errorf("statistics window '%s' must be positive", name)
+	}
+	return Window{Name: name, Duration: duration}, nil
+}
+
+// Statistics of a sensor within the current window
+type Statistics struct {
+	Window string
+	Start  time.Time
+	Min    float64
+	Max    float64
+	Avg    float64
+	Count  int
+}
+
+// accumulator for the statistics of a single sensor and window
+type accumulator struct {
+	start time.Time
+	min   float64
+	max   float64
+	sum   float64
+	count int
+}
+
+// add a value to the accumulator, resetting it if a new window started
+func (acc *accumulator) add(value float64, windowStart time.Time) {
+	if acc.count == 0 || !acc.start.Equal(windowStart) {
+		acc.start = windowStart
+		acc.min = value
+		acc.max = value
+		acc.sum = 0
+		acc.count = 0
+	}
+	if value < acc.min {
+		acc.min = value
+	}
+	if value > acc.max {
+		acc.max = value
+	}
+	acc.sum += value
+	acc.count++
+}
+
+// StatsStore collects the minimum, maximum and average of sensor values for each
+// configured window.
+type StatsStore struct {
+	windows  []Window
+	location *time.Location
+	// accumulators by device ID, property name and window index
+	acc map[string]map[string][]accumulator
+	mu  sync.RWMutex
+}
+
+// Add a sensor value to the statistics of a device
+//  deviceID is the ID of the device whose sensor value to add
+//  propName is the name of the sensor property
+//  value is the sensor value
+//  timestamp is the time the value was obtained
+func (ss *StatsStore) Add(deviceID string, propName string, value float64, timestamp time.Time) {
+	if len(ss.windows) == 0 {
+		return
+	}
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	deviceAcc, found := ss.acc[deviceID]
+	if !found {
+		deviceAcc = make(map[string][]accumulator)
+		ss.acc[deviceID] = deviceAcc
+	}
+	propAcc, found := deviceAcc[propName]
+	if !found {
+		propAcc = make([]accumulator, len(ss.windows))
+		deviceAcc[propName] = propAcc
+	}
+	for i, window := range ss.windows {
+		propAcc[i].add(value, window.StartOf(timestamp, ss.location))
+	}
+}
+
+// Get returns the statistics of a device sensor for each window.
+// Windows that have ended without receiving a new value are not included.
+func (ss *StatsStore) Get(deviceID string, propName string) []Statistics {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	result := make([]Statistics, 0, len(ss.windows))
+	propAcc := ss.acc[deviceID][propName]
+	now := time.Now()
+	for i, acc := range propAcc {
+		window := ss.windows[i]
+		if acc.count == 0 || !acc.start.Equal(window.StartOf(now, ss.location)) {
+			continue
+		}
+		result = append(result, Statistics{
+			Window: window.Name,
+			Start:  acc.start,
+			Min:    acc.min,
+			Max:    acc.max,
+			Avg:    acc.sum / float64(acc.count),
+			Count:  acc.count,
+		})
+	}
+	return result
+}
+
+// GetWindows returns the configured windows
+func (ss *StatsStore) GetWindows() []Window {
+	return ss.windows
+}
+
+// Reset clears all statistics
+func (ss *StatsStore) Reset() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.acc = make(map[string]map[string][]accumulator)
+}
+
+// PropName returns the name of the property that holds a statistic of a sensor
+//  propName is the name of the sensor property, eg temperature
+//  stat is the name of the statistic, eg min, max or avg
+//  window is the name of the window, eg 1h or today
+// For example: temperatureMinToday
+func PropName(propName string, stat string, window string) string {
+	return propName + upperFirst(stat) + upperFirst(window)
+}
+
+// upperFirst returns the text with its first character in upper case
+func upperFirst(text string) string {
+	if text == "" {
+		return text
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// NewStatsStore creates a store for collecting statistics of sensor values
+//  windows to collect statistics over. nil to disable statistics.
+//  location is the timezone used to align the windows to midnight. nil for local time.
+func NewStatsStore(windows []Window, location *time.Location) *StatsStore {
+	if location == nil {
+		location = time.Local
+	}
+	ss := &StatsStore{
+		windows:  windows,
+		location: location,
+		acc:      make(map[string]map[string][]accumulator),
+	}
+	return ss
+}
@@ -0,0 +1,128 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/stats"
+)
+
+const testDevice = "device1"
+const testProp = "temperature"
+
+func TestParseWindow(t *testing.T) {
+	w, err := stats.ParseWindow("1h")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, w.Duration)
+
+	w, err = stats.ParseWindow(stats.WindowToday)
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, w.Duration)
+
+	_, err = stats.ParseWindow("bad")
+	assert.Error(t, err)
+	_, err = stats.ParseWindow("-1h")
+	assert.Error(t, err)
+}
+
+func TestWindowStart(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	w, _ := stats.ParseWindow(stats.WindowToday)
+	ts := time.Date(2022, 6, 1, 23, 30, 0, 0, loc)
+	start := w.StartOf(ts, loc)
+	assert.Equal(t, time.Date(2022, 6, 1, 0, 0, 0, 0, loc), start)
+
+	w, _ = stats.ParseWindow("1h")
+	start = w.StartOf(ts, loc)
+	assert.Equal(t, time.Date(2022, 6, 1, 23, 0, 0, 0, loc), start)
+}
+
+func TestWindowStartDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	today, _ := stats.ParseWindow(stats.WindowToday)
+
+	// 30 October 2022 has 25 hours. The window lasts until the next midnight.
+	ts := time.Date(2022, 10, 30, 23, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 10, 30, 0, 0, 0, 0, loc), today.StartOf(ts, loc))
+	ts = time.Date(2022, 10, 31, 0, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 10, 31, 0, 0, 0, 0, loc), today.StartOf(ts, loc))
+
+	// 27 March 2022 has 23 hours
+	ts = time.Date(2022, 3, 27, 23, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 3, 27, 0, 0, 0, 0, loc), today.StartOf(ts, loc))
+	ts = time.Date(2022, 3, 28, 0, 10, 0, 0, loc)
+	assert.Equal(t, time.Date(2022, 3, 28, 0, 0, 0, 0, loc), today.StartOf(ts, loc))
+}
+
+func TestWindowStartDays(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	// weekly windows start at midnight on Monday
+	week, _ := stats.ParseWindow("168h")
+	ts := time.Date(2022, 6, 5, 12, 0, 0, 0, loc) // Sunday
+	assert.Equal(t, time.Date(2022, 5, 30, 0, 0, 0, 0, loc), week.StartOf(ts, loc))
+	ts = time.Date(2022, 6, 6, 0, 0, 0, 0, loc) // Monday
+	assert.Equal(t, time.Date(2022, 6, 6, 0, 0, 0, 0, loc), week.StartOf(ts, loc))
+
+	twoDays, _ := stats.ParseWindow("48h")
+	start := twoDays.StartOf(ts, loc)
+	assert.Equal(t, 0, start.Hour())
+	assert.True(t, !start.After(ts) && ts.Sub(start) < 48*time.Hour)
+}
+
+func TestWindowStartUnixEpoch(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Amsterdam")
+	require.NoError(t, err)
+	// windows that are not whole days are multiples of their duration since the Unix epoch
+	window, _ := stats.ParseWindow("36h")
+	ts := time.Date(2022, 6, 5, 12, 0, 0, 0, loc)
+	start := window.StartOf(ts, loc)
+	assert.Equal(t, time.Duration(0), start.Sub(time.Unix(0, 0))%(36*time.Hour))
+	assert.True(t, !start.After(ts) && ts.Sub(start) < 36*time.Hour)
+	// 2022-06-04 12:00 UTC is 12765 windows of 36h after the epoch
+	assert.Equal(t, time.Date(2022, 6, 4, 12, 0, 0, 0, time.UTC), start.UTC())
+}
+
+func TestMinMaxAvg(t *testing.T) {
+	w, _ := stats.ParseWindow(stats.WindowToday)
+	ss := stats.NewStatsStore([]stats.Window{w}, nil)
+	now := time.Now()
+	ss.Add(testDevice, testProp, 20, now)
+	ss.Add(testDevice, testProp, 10, now)
+	ss.Add(testDevice, testProp, 30, now)
+
+	result := ss.Get(testDevice, testProp)
+	require.Len(t, result, 1)
+	assert.Equal(t, 10.0, result[0].Min)
+	assert.Equal(t, 30.0, result[0].Max)
+	assert.Equal(t, 20.0, result[0].Avg)
+	assert.Equal(t, 3, result[0].Count)
+
+	ss.Reset()
+	assert.Empty(t, ss.Get(testDevice, testProp))
+}
+
+func TestWindowReset(t *testing.T) {
+	w, _ := stats.ParseWindow("1h")
+	ss := stats.NewStatsStore([]stats.Window{w}, nil)
+	now := time.Now()
+	// a value in the previous window is not included
+	ss.Add(testDevice, testProp, 100, now.Add(-time.Hour))
+	assert.Empty(t, ss.Get(testDevice, testProp))
+
+	ss.Add(testDevice, testProp, 5, now)
+	result := ss.Get(testDevice, testProp)
+	require.Len(t, result, 1)
+	assert.Equal(t, 5.0, result[0].Max)
+	assert.Equal(t, 1, result[0].Count)
+}
+
+func TestPropName(t *testing.T) {
+	assert.Equal(t, "temperatureMinToday", stats.PropName("temperature", "min", "today"))
+	assert.Equal(t, "humidityAvg1h", stats.PropName("humidity", "avg", "1h"))
+}
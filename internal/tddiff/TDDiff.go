@@ -0,0 +1,92 @@
+// Package tddiff with fingerprinting and comparison of Thing Description documents
+package tddiff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/wostzone/wost-go/pkg/thing"
+)
+
+// tdContent holds the parts of a TD that describe the Thing, without the timestamps
+type tdContent struct {
+	ID          string                               `json:"id"`
+	AtType      string                               `json:"@type"`
+	Title       string                               `json:"title"`
+	Description string                               `json:"description"`
+	Properties  map[string]*thing.PropertyAffordance `json:"properties"`
+	Actions     map[string]*thing.ActionAffordance   `json:"actions"`
+	Events      map[string]*thing.EventAffordance    `json:"events"`
+}
+
+// Fingerprint returns a stable hash of the content of a TD
+// The created and modified timestamps are not included, so TDs generated at different
+// times from the same node have the same fingerprint.
+func Fingerprint(td *thing.ThingTD) string {
+	content := tdContent{
+		ID:          td.ID,
+		AtType:      td.AtType,
+		Title:       td.Title,
+		Description: td.Description,
+		Properties:  td.Properties,
+		Actions:     td.Actions,
+		Events:      td.Events,
+	}
+	// map keys are serialized in sorted order
+	data, _ := json.Marshal(content)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// Diff returns a human readable list of the differences between two TDs
+func Diff(oldTD *thing.ThingTD, newTD *thing.ThingTD) []string {
+	changes := make([]string, 0)
+	if oldTD.AtType != newTD.AtType {
+		changes = append(changes, fmt.Sprintf("@type changed from '%s' to '%s'", oldTD.AtType, newTD.AtType))
+	}
+	if oldTD.Title != newTD.Title {
+		changes = append(changes, fmt.Sprintf("title changed from '%s' to '%s'", oldTD.Title, newTD.Title))
+	}
+	if oldTD.Description != newTD.Description {
+		changes = append(changes, "description changed")
+	}
+	changes = append(changes, diffAffordances("property", toJSONMap(oldTD.Properties), toJSONMap(newTD.Properties))...)
+	changes = append(changes, diffAffordances("action", toJSONMap(oldTD.Actions), toJSONMap(newTD.Actions))...)
+	changes = append(changes, diffAffordances("event", toJSONMap(oldTD.Events), toJSONMap(newTD.Events))...)
+	return changes
+}
+
+// diffAffordances compares two maps of serialized affordances by name
+func diffAffordances(kind string, oldAff map[string]string, newAff map[string]string) []string {
+	changes := make([]string, 0)
+	for name, oldJSON := range oldAff {
+		newJSON, found := newAff[name]
+		if !found {
+			changes = append(changes, fmt.Sprintf("%s '%s' removed", kind, name))
+		} else if newJSON != oldJSON {
+			changes = append(changes, fmt.Sprintf("%s '%s' changed", kind, name))
+		}
+	}
+	for name := range newAff {
+		if _, found := oldAff[name]; !found {
+			changes = append(changes, fmt.Sprintf("%s '%s' added", kind, name))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// toJSONMap serializes each affordance of a map of affordances
+func toJSONMap(affordances interface{}) map[string]string {
+	result := make(map[string]string)
+	data, _ := json.Marshal(affordances)
+	var rawMap map[string]json.RawMessage
+	_ = json.Unmarshal(data, &rawMap)
+	for name, raw := range rawMap {
+		result[name] = string(raw)
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+package tddiff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/tddiff"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+const testThingID = "urn:local:owserver:2A000003BB170B28:sensor"
+
+func createTestTD() *thing.ThingTD {
+	tdoc := thing.CreateTD(testThingID, "DS18B20", vocab.DeviceTypeSensor)
+	prop := tdoc.AddProperty("temperature", "Temperature", vocab.WoTDataTypeNumber)
+	prop.ReadOnly = true
+	tdoc.AddProperty("Resolution", "Resolution", vocab.WoTDataTypeString)
+	return tdoc
+}
+
+func TestFingerprintStable(t *testing.T) {
+	td1 := createTestTD()
+	time.Sleep(time.Millisecond * 2)
+	td2 := createTestTD()
+	assert.Equal(t, tddiff.Fingerprint(td1), tddiff.Fingerprint(td2))
+	assert.Empty(t, tddiff.Diff(td1, td2))
+}
+
+func TestDiff(t *testing.T) {
+	oldTD := createTestTD()
+	newTD := createTestTD()
+	newTD.Title = "Boiler supply"
+	newTD.GetProperty("Resolution").ReadOnly = false
+	newTD.AddProperty("UserByte1", "UserByte1", vocab.WoTDataTypeString)
+	delete(newTD.Properties, "temperature")
+
+	assert.NotEqual(t, tddiff.Fingerprint(oldTD), tddiff.Fingerprint(newTD))
+	changes := tddiff.Diff(oldTD, newTD)
+	assert.Equal(t, []string{
+		"title changed from 'DS18B20' to 'Boiler supply'",
+		"property 'Resolution' changed",
+		"property 'UserByte1' added",
+		"property 'temperature' removed",
+	}, changes)
+}
@@ -0,0 +1,175 @@
+// Package thingmodel with WoT Thing Models of 1-wire device families
+package thingmodel
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/wostzone/wost-go/pkg/thing"
+)
+
+// ModelContext is the JSON-LD context of Thing Models
+const ModelContext = "https://www.w3.org/2022/wot/td/v1.1"
+
+// ModelType is the JSON-LD type of Thing Models
+const ModelType = "tm:ThingModel"
+
+// ModelVersion is the version of the generated Thing Models
+const ModelVersion = "1.0.0"
+
+// ModelFileExt is the file extension of exported Thing Models
+const ModelFileExt = ".tm.jsonld"
+
+// ThingModel describes the affordances of the devices of a family
+// See https://www.w3.org/TR/wot-thing-description11/#thing-model
+type ThingModel struct {
+	AtContext   []string                             `json:"@context"`
+	AtType      []string                             `json:"@type"`
+	Title       string                               `json:"title"`
+	Description string                               `json:"description,omitempty"`
+	Version     map[string]string                    `json:"version"`
+	Properties  map[string]*thing.PropertyAffordance `json:"properties,omitempty"`
+	Actions     map[string]*thing.ActionAffordance   `json:"actions,omitempty"`
+	Events      map[string]*thing.EventAffordance    `json:"events,omitempty"`
+	// Optional holds the JSON pointers of the affordances that not all devices of the family have
+	Optional []string `json:"tm:optional,omitempty"`
+}
+
+// Filename returns the file name of the exported model, eg DS18B20.tm.jsonld
+// There is one model per device family so the name is that of the family.
+func (tm *ThingModel) Filename() string {
+	return ModelFilename(tm.Title)
+}
+
+// Instantiate copies the affordances of the model into a TD
+// The affordances are copied so changes to the TD do not affect the model.
+func (tm *ThingModel) Instantiate(tdoc *thing.ThingTD) {
+	var affordances struct {
+		Properties map[string]*thing.PropertyAffordance `json:"properties"`
+		Actions    map[string]*thing.ActionAffordance   `json:"actions"`
+		Events     map[string]*thing.EventAffordance    `json:"events"`
+	}
+	data, _ := json.Marshal(tm)
+	_ = json.Unmarshal(data, &affordances)
+	for name, prop := range affordances.Properties {
+		tdoc.UpdateProperty(name, prop)
+	}
+	for name, action := range affordances.Actions {
+		tdoc.UpdateAction(name, action)
+	}
+	for name, event := range affordances.Events {
+		tdoc.UpdateEvent(name, event)
+	}
+}
+
+// Merge adds the affordances of another model of the same device family
+// Devices of a family can report different attributes. Affordances that are not in both
+// models are listed as optional so the model describes all devices of the family.
+func (tm *ThingModel) Merge(other *ThingModel) {
+	pointers := tm.affordancePointers()
+	otherPointers := other.affordancePointers()
+	if tm.Properties == nil {
+		tm.Properties = make(map[string]*thing.PropertyAffordance)
+	}
+	if tm.Actions == nil {
+		tm.Actions = make(map[string]*thing.ActionAffordance)
+	}
+	if tm.Events == nil {
+		tm.Events = make(map[string]*thing.EventAffordance)
+	}
+	for name, prop := range other.Properties {
+		if _, found := tm.Properties[name]; !found {
+			tm.Properties[name] = prop
+		}
+	}
+	for name, action := range other.Actions {
+		if _, found := tm.Actions[name]; !found {
+			tm.Actions[name] = action
+		}
+	}
+	for name, event := range other.Events {
+		if _, found := tm.Events[name]; !found {
+			tm.Events[name] = event
+		}
+	}
+	optional := make(map[string]bool)
+	for _, pointer := range append(tm.Optional, other.Optional...) {
+		optional[pointer] = true
+	}
+	for pointer := range pointers {
+		if !otherPointers[pointer] {
+			optional[pointer] = true
+		}
+	}
+	for pointer := range otherPointers {
+		if !pointers[pointer] {
+			optional[pointer] = true
+		}
+	}
+	tm.Optional = make([]string, 0, len(optional))
+	for pointer := range optional {
+		tm.Optional = append(tm.Optional, pointer)
+	}
+	sort.Strings(tm.Optional)
+}
+
+// affordancePointers returns the JSON pointers of the affordances of the model, eg /properties/temperature
+func (tm *ThingModel) affordancePointers() map[string]bool {
+	pointers := make(map[string]bool)
+	for name := range tm.Properties {
+		pointers["/properties/"+name] = true
+	}
+	for name := range tm.Actions {
+		pointers["/actions/"+name] = true
+	}
+	for name := range tm.Events {
+		pointers["/events/"+name] = true
+	}
+	return pointers
+}
+
+// Save the model as JSON-LD in the given folder
+// This returns the path of the saved file.
+func (tm *ThingModel) Save(folder string) (string, error) {
+	data, _ := json.MarshalIndent(tm, "", "  ")
+	filePath := path.Join(folder, tm.Filename())
+	err := ioutil.WriteFile(filePath, data, 0644)
+	return filePath, err
+}
+
+// ModelFilename returns the file name of a model, eg EDS0068.tm.jsonld
+func ModelFilename(modelName string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == os.PathSeparator || r == ' ' {
+			return '_'
+		}
+		return r
+	}, modelName)
+	return name + ModelFileExt
+}
+
+// NewThingModel creates a Thing Model with the affordances of a template TD
+// The template TD is only used for its affordances. Its ID and timestamps are not included.
+//  modelName is the name of the device family, eg EDS0068
+//  description of the model
+//  template is the TD with the affordances of the model
+func NewThingModel(modelName string, description string, template *thing.ThingTD) *ThingModel {
+	tm := &ThingModel{
+		AtContext:   []string{ModelContext},
+		AtType:      []string{ModelType},
+		Title:       modelName,
+		Description: description,
+		Version:     map[string]string{"model": ModelVersion},
+		Properties:  template.Properties,
+		Actions:     template.Actions,
+		Events:      template.Events,
+	}
+	if template.AtType != "" {
+		tm.AtType = append(tm.AtType, template.AtType)
+	}
+	return tm
+}
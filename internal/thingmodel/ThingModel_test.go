@@ -0,0 +1,79 @@
+package thingmodel_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/wostzone/owserver/internal/thingmodel"
+	"github.com/wostzone/wost-go/pkg/thing"
+	"github.com/wostzone/wost-go/pkg/vocab"
+)
+
+func createTestModel() *thingmodel.ThingModel {
+	template := thing.CreateTD("", "DS18B20", vocab.DeviceTypeThermometer)
+	prop := template.AddProperty(vocab.PropNameTemperature, "Temperature", vocab.WoTDataTypeNumber)
+	prop.AtType = "https://saref.etsi.org/core/Temperature"
+	template.AddEvent(vocab.PropNameTemperature, "Temperature", vocab.WoTDataTypeNumber)
+	return thingmodel.NewThingModel("DS18B20", "Programmable resolution thermometer", template)
+}
+
+func TestInstantiate(t *testing.T) {
+	tm := createTestModel()
+	tdoc := thing.CreateTD("urn:test:thing1", "Boiler supply", vocab.DeviceTypeThermometer)
+	tm.Instantiate(tdoc)
+	prop := tdoc.GetProperty(vocab.PropNameTemperature)
+	require.NotNil(t, prop)
+	assert.Equal(t, "https://saref.etsi.org/core/Temperature", prop.AtType)
+	assert.NotNil(t, tdoc.GetEvent(vocab.PropNameTemperature))
+
+	// the TD has its own copy of the affordances
+	prop.Title = "changed"
+	assert.Equal(t, "Temperature", tm.Properties[vocab.PropNameTemperature].Title)
+}
+
+func TestSave(t *testing.T) {
+	tm := createTestModel()
+	filePath, err := tm.Save(os.TempDir())
+	require.NoError(t, err)
+	defer os.Remove(filePath)
+	assert.Contains(t, filePath, "DS18B20"+thingmodel.ModelFileExt)
+
+	data, err := ioutil.ReadFile(filePath)
+	require.NoError(t, err)
+	var asMap map[string]interface{}
+	err = json.Unmarshal(data, &asMap)
+	require.NoError(t, err)
+	assert.Contains(t, asMap["@type"], thingmodel.ModelType)
+	assert.NotContains(t, asMap, "id")
+}
+
+func TestMerge(t *testing.T) {
+	tm1 := createTestModel()
+	tm2 := createTestModel()
+	tm1.Merge(tm2)
+	assert.Empty(t, tm1.Optional)
+	assert.Equal(t, tm2.Filename(), tm1.Filename())
+
+	// a device of the same family with another attribute shares the model
+	template := thing.CreateTD("", "DS18B20", vocab.DeviceTypeThermometer)
+	template.AddProperty(vocab.PropNameTemperature, "Temperature", vocab.WoTDataTypeNumber)
+	template.AddProperty("alarm", "Alarm", vocab.WoTDataTypeBool)
+	tm3 := thingmodel.NewThingModel("DS18B20", "", template)
+	assert.Equal(t, tm1.Filename(), tm3.Filename())
+	tm1.Merge(tm3)
+	assert.Contains(t, tm1.Properties, "alarm")
+	assert.Contains(t, tm1.Properties, vocab.PropNameTemperature)
+	assert.Equal(t, []string{"/events/" + vocab.PropNameTemperature, "/properties/alarm"}, tm1.Optional)
+
+	data, err := json.Marshal(tm1)
+	require.NoError(t, err)
+	var asMap map[string]interface{}
+	err = json.Unmarshal(data, &asMap)
+	require.NoError(t, err)
+	assert.Len(t, asMap["tm:optional"], 2)
+}
@@ -0,0 +1,158 @@
+// Package validation with rejection of implausible sensor readings
+package validation
+
+import (
+	"sync"
+)
+
+// Sentinel values reported by DS18B20 temperature sensors
+const (
+	// SentinelPowerOnReset is reported by a DS18B20 after a power-on reset or brown-out
+	SentinelPowerOnReset = 85.0
+	// SentinelDisconnected is reported by the EDS gateway when it cannot read the sensor
+	SentinelDisconnected = -127.0
+)
+
+// sentinelMargin is the maximum difference between the last good value and a sentinel value
+// for the sentinel value to be accepted as a real reading.
+const sentinelMargin = 5.0
+
+// Rule with the plausible range and sentinel values of a sensor
+// Min and Max are ignored if they are equal.
+type Rule struct {
+	// Min is the lowest plausible value
+	Min float64 `yaml:"min"`
+	// Max is the highest plausible value
+	Max float64 `yaml:"max"`
+	// Sentinels are values the sensor reports on failure
+	Sentinels []float64 `yaml:"sentinels,omitempty"`
+}
+
+// DefaultRules with the plausible ranges of sensors by 1-wire family and property name
+var DefaultRules = map[string]map[string]Rule{
+	// DS18B20 temperature sensor
+	"28": {
+		"temperature": {Min: -55, Max: 125, Sentinels: []float64{SentinelPowerOnReset, SentinelDisconnected}},
+	},
+	// EDS0068 and other EDS environmental sensors
+	"7E": {
+		"temperature":         {Min: -40, Max: 125, Sentinels: []float64{SentinelDisconnected}},
+		"humidity":            {Min: 0, Max: 100},
+		"atmosphericPressure": {Min: 300, Max: 1100},
+		"luminance":           {Min: 0, Max: 200000},
+	},
+}
+
+// sensorState holds the last good value and rejection count of a sensor
+type sensorState struct {
+	lastGood   float64
+	hasGood    bool
+	rejections int
+}
+
+// Validator rejects implausible readings and holds the last good value of each sensor
+type Validator struct {
+	// rules by 1-wire family and property name
+	familyRules map[string]map[string]Rule
+	// rules by ROM ID and property name. These override the family rules.
+	deviceRules map[string]map[string]Rule
+	// state by ROM ID and property name
+	sensors map[string]map[string]*sensorState
+	mu      sync.Mutex
+}
+
+// GetRule returns the validation rule of a sensor and whether a rule exists
+// Device rules take precedence over family rules.
+func (v *Validator) GetRule(romID string, family string, propName string) (rule Rule, found bool) {
+	rule, found = v.deviceRules[romID][propName]
+	if !found {
+		rule, found = v.familyRules[family][propName]
+	}
+	return rule, found
+}
+
+// GetRejections returns the number of rejected readings of a device since startup
+func (v *Validator) GetRejections(romID string) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	count := 0
+	for _, state := range v.sensors[romID] {
+		count += state.rejections
+	}
+	return count
+}
+
+// Validate a sensor reading
+// A sentinel value is accepted if the last good value is close to it, as the sensor can
+// legitimately report that value.
+// This returns the reading if it is valid, or the last good value if it is not.
+// hasValue is false if the reading is invalid and there is no last good value.
+//  romID of the device
+//  family is the 1-wire family of the device, eg "28"
+//  propName is the vocabulary name of the sensor, eg "temperature"
+//  value is the raw sensor reading
+func (v *Validator) Validate(romID string, family string, propName string, value float64) (
+	goodValue float64, isValid bool, hasValue bool) {
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	deviceSensors, found := v.sensors[romID]
+	if !found {
+		deviceSensors = make(map[string]*sensorState)
+		v.sensors[romID] = deviceSensors
+	}
+	state, found := deviceSensors[propName]
+	if !found {
+		state = &sensorState{}
+		deviceSensors[propName] = state
+	}
+	rule, hasRule := v.GetRule(romID, family, propName)
+	isValid = !hasRule || v.isPlausible(rule, state, value)
+	if isValid {
+		state.lastGood = value
+		state.hasGood = true
+		return value, true, true
+	}
+	state.rejections++
+	return state.lastGood, false, state.hasGood
+}
+
+// isPlausible returns true if the value is within the rule range and is not a sentinel
+func (v *Validator) isPlausible(rule Rule, state *sensorState, value float64) bool {
+	for _, sentinel := range rule.Sentinels {
+		if value == sentinel {
+			if !state.hasGood || state.lastGood-value > sentinelMargin || value-state.lastGood > sentinelMargin {
+				return false
+			}
+		}
+	}
+	if rule.Min != rule.Max && (value < rule.Min || value > rule.Max) {
+		return false
+	}
+	return true
+}
+
+// NewValidator creates a validator for sensor readings
+//  familyRules with rules by 1-wire family and property name that override DefaultRules, nil for none
+//  deviceRules with rules by ROM ID and property name, nil for none
+func NewValidator(familyRules map[string]map[string]Rule, deviceRules map[string]map[string]Rule) *Validator {
+	v := &Validator{
+		familyRules: make(map[string]map[string]Rule),
+		deviceRules: deviceRules,
+		sensors:     make(map[string]map[string]*sensorState),
+	}
+	if v.deviceRules == nil {
+		v.deviceRules = make(map[string]map[string]Rule)
+	}
+	for _, rules := range []map[string]map[string]Rule{DefaultRules, familyRules} {
+		for family, propRules := range rules {
+			if v.familyRules[family] == nil {
+				v.familyRules[family] = make(map[string]Rule)
+			}
+			for propName, rule := range propRules {
+				v.familyRules[family][propName] = rule
+			}
+		}
+	}
+	return v
+}
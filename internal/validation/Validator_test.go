@@ -0,0 +1,66 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/wostzone/owserver/internal/validation"
+)
+
+const testDevice = "2A000003BB170B28"
+const testFamily = "28"
+const testProp = "temperature"
+
+func TestRejectPowerOnReset(t *testing.T) {
+	v := validation.NewValidator(nil, nil)
+	value, isValid, hasValue := v.Validate(testDevice, testFamily, testProp, 20.5)
+	assert.True(t, isValid)
+	assert.True(t, hasValue)
+	assert.Equal(t, 20.5, value)
+
+	// the last good value is held
+	value, isValid, hasValue = v.Validate(testDevice, testFamily, testProp, validation.SentinelPowerOnReset)
+	assert.False(t, isValid)
+	assert.True(t, hasValue)
+	assert.Equal(t, 20.5, value)
+
+	_, isValid, _ = v.Validate(testDevice, testFamily, testProp, validation.SentinelDisconnected)
+	assert.False(t, isValid)
+	assert.Equal(t, 2, v.GetRejections(testDevice))
+}
+
+func TestAcceptSentinelNearLastValue(t *testing.T) {
+	v := validation.NewValidator(nil, nil)
+	v.Validate(testDevice, testFamily, testProp, 83.5)
+	_, isValid, _ := v.Validate(testDevice, testFamily, testProp, validation.SentinelPowerOnReset)
+	assert.True(t, isValid)
+}
+
+func TestNoGoodValue(t *testing.T) {
+	v := validation.NewValidator(nil, nil)
+	_, isValid, hasValue := v.Validate(testDevice, testFamily, testProp, validation.SentinelPowerOnReset)
+	assert.False(t, isValid)
+	assert.False(t, hasValue)
+}
+
+func TestRangeRules(t *testing.T) {
+	familyRules := map[string]map[string]validation.Rule{
+		"7E": {"humidity": {Min: 5, Max: 95}},
+	}
+	deviceRules := map[string]map[string]validation.Rule{
+		testDevice: {testProp: {Min: 0, Max: 40}},
+	}
+	v := validation.NewValidator(familyRules, deviceRules)
+	_, isValid, _ := v.Validate("C100100000267C7E", "7E", "humidity", 98)
+	assert.False(t, isValid)
+	// default rules of the family still apply
+	_, isValid, _ = v.Validate("C100100000267C7E", "7E", "atmosphericPressure", 20)
+	assert.False(t, isValid)
+	// device rule overrides the family rule
+	_, isValid, _ = v.Validate(testDevice, testFamily, testProp, 60)
+	assert.False(t, isValid)
+	// sensors without rules are always valid
+	_, isValid, _ = v.Validate(testDevice, testFamily, "unknown", -1000)
+	assert.True(t, isValid)
+}